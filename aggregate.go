@@ -0,0 +1,513 @@
+package dataframe
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Calculation applied to a column by GroupBy.
+type AggregateFunc int
+
+const (
+	AggSum AggregateFunc = iota
+	// Number of non-empty values, or the number of rows when no column is given.
+	AggCount
+	AggMin
+	AggMax
+	AggMean
+	// Approximate number of distinct values, within about 2% for large counts. Groups with up to 64
+	// distinct values are counted exactly in at most 512 bytes, larger groups use a fixed 4 KB each.
+	AggDistinct
+	// Approximate quantile of the values, set with Aggregation.Quantile.
+	AggQuantile
+)
+
+func (f AggregateFunc) String() string {
+	switch f {
+	case AggCount:
+		return "Count"
+	case AggMin:
+		return "Min"
+	case AggMax:
+		return "Max"
+	case AggMean:
+		return "Mean"
+	case AggDistinct:
+		return "Distinct"
+	case AggQuantile:
+		return "Quantile"
+	default:
+		return "Sum"
+	}
+}
+
+// A single calculation computed for every group.
+type Aggregation struct {
+	Func   AggregateFunc
+	Column string
+	// Between 0 and 1 for AggQuantile, e.g. 0.5 for the median.
+	Quantile float64
+	// Name of the result column. Defaults to the function and column, e.g. "Sum Cost" or "P95 Cost".
+	As string
+}
+
+func (a Aggregation) name() string {
+	if len(a.As) > 0 {
+		return a.As
+	}
+
+	prefix := a.Func.String()
+	if a.Func == AggQuantile {
+		prefix = "P" + strconv.FormatFloat(a.Quantile*100, 'f', -1, 64)
+	}
+	if len(a.Column) == 0 {
+		return prefix
+	}
+	return prefix + " " + a.Column
+}
+
+func (a Aggregation) numeric() bool {
+	switch a.Func {
+	case AggSum, AggMin, AggMax, AggMean, AggQuantile:
+		return true
+	default:
+		return false
+	}
+}
+
+// Computes aggregations per group over rows that are added one at a time, so files larger than memory
+// can be summarized. Memory grows with the number of groups but not with the number of rows.
+// Empty values are ignored by every aggregation. A GroupBy is not safe for concurrent use.
+type GroupBy struct {
+	keys         []string
+	aggregations []Aggregation
+	seed         maphash.Seed
+
+	groups map[string]*aggGroup
+	order  []*aggGroup
+	rows   int64
+
+	// Column positions resolved for the last header map seen.
+	headers      map[string]int
+	keyPos       []int
+	aggPos       []int
+	resolveError error
+}
+
+type aggGroup struct {
+	key    []string
+	states []aggState
+}
+
+type aggState struct {
+	count    int64
+	sum      float64
+	min      float64
+	max      float64
+	distinct *hyperLogLog
+	quantile *p2Quantile
+}
+
+// Creates a GroupBy that groups rows by the key columns. Without key columns every row is in one group.
+func NewGroupBy(keys []string, aggregations ...Aggregation) (*GroupBy, error) {
+	if len(aggregations) == 0 {
+		return nil, errors.New("group by: no aggregations provided")
+	}
+
+	names := make(map[string]bool)
+	for _, key := range keys {
+		names[key] = true
+	}
+	for _, a := range aggregations {
+		if a.Func != AggCount && len(a.Column) == 0 {
+			return nil, fmt.Errorf("group by: %s requires a column", a.Func)
+		}
+		if a.Func == AggQuantile && (a.Quantile < 0 || a.Quantile > 1) {
+			return nil, fmt.Errorf("group by: quantile %v must be between 0 and 1", a.Quantile)
+		}
+		if names[a.name()] {
+			return nil, fmt.Errorf("group by: result column '%s' is used more than once", a.name())
+		}
+		names[a.name()] = true
+	}
+
+	return &GroupBy{
+		keys:         keys,
+		aggregations: aggregations,
+		seed:         maphash.MakeSeed(),
+		groups:       make(map[string]*aggGroup),
+	}, nil
+}
+
+// Adds a single row. Returns an error when a column is missing or a numeric aggregation gets text.
+func (g *GroupBy) Add(row StreamingRecord) error {
+	if err := g.resolve(row.Headers); err != nil {
+		return err
+	}
+	g.rows++
+
+	var sb strings.Builder
+	for _, pos := range g.keyPos {
+		sb.WriteString(row.Data[pos])
+		sb.WriteByte(0)
+	}
+
+	group, ok := g.groups[sb.String()]
+	if !ok {
+		group = &aggGroup{key: make([]string, len(g.keyPos)), states: make([]aggState, len(g.aggregations))}
+		for i, pos := range g.keyPos {
+			group.key[i] = strings.Clone(row.Data[pos])
+		}
+		g.groups[sb.String()] = group
+		g.order = append(g.order, group)
+	}
+
+	for i, a := range g.aggregations {
+		state := &group.states[i]
+		if g.aggPos[i] < 0 {
+			state.count++
+			continue
+		}
+
+		val := row.Data[g.aggPos[i]]
+		if len(val) == 0 {
+			continue
+		}
+
+		switch {
+		case a.Func == AggDistinct:
+			if state.distinct == nil {
+				state.distinct = &hyperLogLog{}
+			}
+			state.distinct.add(maphash.String(g.seed, val))
+			continue
+		case !a.numeric():
+			state.count++
+			continue
+		}
+
+		num, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("group by: row %d: column '%s' is not numeric: %w", g.rows, a.Column, err)
+		}
+		if state.count == 0 || num < state.min {
+			state.min = num
+		}
+		if state.count == 0 || num > state.max {
+			state.max = num
+		}
+		state.count++
+		state.sum += num
+
+		if a.Func == AggQuantile {
+			if state.quantile == nil {
+				state.quantile = &p2Quantile{p: a.Quantile}
+			}
+			state.quantile.add(num)
+		}
+	}
+	return nil
+}
+
+// Adds every row of a DataFrame, such as a chunk from StreamChunks.
+func (g *GroupBy) AddFrame(frame DataFrame) error {
+	for _, row := range frame.FrameRecords {
+		if err := g.Add(StreamingRecord{Data: row.Data, Headers: frame.Headers}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finds the key and aggregation columns in the header map, reusing the last result when rows share it.
+func (g *GroupBy) resolve(headers map[string]int) error {
+	if g.headers != nil && sameMap(g.headers, headers) {
+		return g.resolveError
+	}
+	g.headers = headers
+	g.keyPos = g.keyPos[:0]
+	g.aggPos = g.aggPos[:0]
+	g.resolveError = nil
+
+	for _, key := range g.keys {
+		pos, ok := headers[key]
+		if !ok {
+			g.resolveError = fmt.Errorf("group by: column '%s' does not exist", key)
+			return g.resolveError
+		}
+		g.keyPos = append(g.keyPos, pos)
+	}
+	for _, a := range g.aggregations {
+		if len(a.Column) == 0 {
+			g.aggPos = append(g.aggPos, -1)
+			continue
+		}
+		pos, ok := headers[a.Column]
+		if !ok {
+			g.resolveError = fmt.Errorf("group by: column '%s' does not exist", a.Column)
+			return g.resolveError
+		}
+		g.aggPos = append(g.aggPos, pos)
+	}
+	return nil
+}
+
+// Returns a DataFrame with the key columns followed by one column per aggregation and one row
+// per group in the order the groups were first seen. Aggregations without values are left empty.
+func (g *GroupBy) Result() DataFrame {
+	headers := make([]string, 0, len(g.keys)+len(g.aggregations))
+	headers = append(headers, g.keys...)
+	for _, a := range g.aggregations {
+		headers = append(headers, a.name())
+	}
+	frame := CreateNewDataFrame(headers)
+
+	for _, group := range g.order {
+		data := make([]string, 0, len(headers))
+		data = append(data, group.key...)
+		for i, a := range g.aggregations {
+			data = append(data, group.states[i].value(a))
+		}
+		frame.FrameRecords = append(frame.FrameRecords, Record{Data: data})
+	}
+	return frame
+}
+
+func (s aggState) value(a Aggregation) string {
+	switch a.Func {
+	case AggCount:
+		return strconv.FormatInt(s.count, 10)
+	case AggDistinct:
+		if s.distinct == nil {
+			return "0"
+		}
+		return strconv.FormatInt(int64(math.Round(s.distinct.estimate())), 10)
+	}
+
+	if s.count == 0 {
+		return ""
+	}
+
+	var v float64
+	switch a.Func {
+	case AggMin:
+		v = s.min
+	case AggMax:
+		v = s.max
+	case AggMean:
+		v = s.sum / float64(s.count)
+	case AggQuantile:
+		v = s.quantile.value()
+	default:
+		v = s.sum
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Aggregates every row sent to c, which is read until it is closed, even when an error occurs,
+// so the producer is never left blocked.
+func AggregateStream(c <-chan StreamingRecord, keys []string, aggregations ...Aggregation) (DataFrame, error) {
+	g, err := NewGroupBy(keys, aggregations...)
+	if err != nil {
+		for range c {
+		}
+		return DataFrame{}, err
+	}
+
+	for row := range c {
+		if err != nil {
+			continue
+		}
+		err = g.Add(row)
+	}
+	if err != nil {
+		return DataFrame{}, err
+	}
+	return g.Result(), nil
+}
+
+// Aggregates every DataFrame sent to c, such as the chunks from StreamChunks. The channel is read until it is closed.
+func AggregateChunks(c <-chan DataFrame, keys []string, aggregations ...Aggregation) (DataFrame, error) {
+	g, err := NewGroupBy(keys, aggregations...)
+	if err != nil {
+		for range c {
+		}
+		return DataFrame{}, err
+	}
+
+	for chunk := range c {
+		if err != nil {
+			continue
+		}
+		err = g.AddFrame(chunk)
+	}
+	if err != nil {
+		return DataFrame{}, err
+	}
+	return g.Result(), nil
+}
+
+// Number of bits of the hash selecting a HyperLogLog register, giving 4096 registers and a
+// standard error of about 1.6%.
+const hllPrecision = 12
+
+// Number of distinct hashes kept before switching to registers, so small groups stay small.
+const hllSparseLimit = 64
+
+// Estimates the number of distinct values in a fixed amount of memory. The hashes are kept as they
+// are until there are more than hllSparseLimit of them.
+type hyperLogLog struct {
+	sparse    []uint64
+	registers *[1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(hash uint64) {
+	if h.registers == nil {
+		if slices.Contains(h.sparse, hash) {
+			return
+		}
+		if len(h.sparse) < hllSparseLimit {
+			h.sparse = append(h.sparse, hash)
+			return
+		}
+		h.registers = new([1 << hllPrecision]uint8)
+		for _, sparse := range h.sparse {
+			h.addRegister(sparse)
+		}
+		h.sparse = nil
+	}
+	h.addRegister(hash)
+}
+
+func (h *hyperLogLog) addRegister(hash uint64) {
+	idx := hash >> (64 - hllPrecision)
+	// The marker bit bounds the rank when the remaining bits are all zero.
+	rest := hash<<hllPrecision | 1<<(hllPrecision-1)
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() float64 {
+	if h.registers == nil {
+		return float64(len(h.sparse))
+	}
+	m := float64(len(h.registers))
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+	// Linear counting is more accurate while many registers are still empty.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return estimate
+}
+
+// Estimates a quantile with the P² algorithm, which keeps five markers instead of every value.
+type p2Quantile struct {
+	p       float64
+	count   int
+	heights [5]float64
+	pos     [5]float64
+	desired [5]float64
+	step    [5]float64
+}
+
+func (q *p2Quantile) add(x float64) {
+	if q.count < 5 {
+		q.heights[q.count] = x
+		q.count++
+		if q.count == 5 {
+			sort.Float64s(q.heights[:])
+			p := q.p
+			q.pos = [5]float64{1, 2, 3, 4, 5}
+			q.desired = [5]float64{1, 1 + 2*p, 1 + 4*p, 3 + 2*p, 5}
+			q.step = [5]float64{0, p / 2, p, (1 + p) / 2, 1}
+		}
+		return
+	}
+	q.count++
+
+	// Find the cell holding x and widen the extremes when needed.
+	var k int
+	switch {
+	case x < q.heights[0]:
+		q.heights[0] = x
+		k = 0
+	case x >= q.heights[4]:
+		q.heights[4] = x
+		k = 3
+	default:
+		for k = 0; k < 3; k++ {
+			if x < q.heights[k+1] {
+				break
+			}
+		}
+	}
+
+	for i := k + 1; i < 5; i++ {
+		q.pos[i]++
+	}
+	for i := range q.desired {
+		q.desired[i] += q.step[i]
+	}
+
+	// Move the middle markers towards their desired positions.
+	for i := 1; i <= 3; i++ {
+		d := q.desired[i] - q.pos[i]
+		if (d >= 1 && q.pos[i+1]-q.pos[i] > 1) || (d <= -1 && q.pos[i-1]-q.pos[i] < -1) {
+			sign := 1.0
+			if d < 0 {
+				sign = -1
+			}
+			h := q.parabolic(i, sign)
+			if q.heights[i-1] < h && h < q.heights[i+1] {
+				q.heights[i] = h
+			} else {
+				q.heights[i] = q.linear(i, sign)
+			}
+			q.pos[i] += sign
+		}
+	}
+}
+
+func (q *p2Quantile) parabolic(i int, d float64) float64 {
+	n, h := q.pos, q.heights
+	return h[i] + d/(n[i+1]-n[i-1])*((n[i]-n[i-1]+d)*(h[i+1]-h[i])/(n[i+1]-n[i])+(n[i+1]-n[i]-d)*(h[i]-h[i-1])/(n[i]-n[i-1]))
+}
+
+func (q *p2Quantile) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return q.heights[i] + d*(q.heights[j]-q.heights[i])/(q.pos[j]-q.pos[i])
+}
+
+// Current estimate. Exact while five or fewer values were added.
+func (q *p2Quantile) value() float64 {
+	if q.count == 0 {
+		return math.NaN()
+	}
+	if q.count <= 5 {
+		values := append([]float64(nil), q.heights[:q.count]...)
+		sort.Float64s(values)
+		return values[int(math.Round(q.p*float64(q.count-1)))]
+	}
+	return q.heights[2]
+}
@@ -1,19 +1,123 @@
 package dataframe
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
+// Settings used to connect to S3 or an S3 compatible store. The zero value uses the default
+// AWS credential chain: environment variables, shared config files and instance or container roles.
+type S3Config struct {
+	Region string
+	// Static credentials. Leave empty to use the default credential chain.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Named profile from the shared config and credentials files.
+	Profile string
+	// Custom endpoint for S3 compatible stores such as MinIO, e.g. http://localhost:9000.
+	Endpoint string
+	// Address buckets as endpoint/bucket instead of bucket.endpoint. Most S3 compatible stores need this.
+	ForcePathStyle bool
+	// Connect over http instead of https.
+	DisableSSL bool
+	// Client used for requests. Defaults to the SDK's client.
+	HTTPClient *http.Client
+}
+
+// Creates an AWS session from the configuration without touching the process environment.
+func (c S3Config) session() (*session.Session, error) {
+	cfg := aws.NewConfig()
+
+	if len(c.Region) > 0 {
+		cfg = cfg.WithRegion(c.Region)
+	}
+	if len(c.AccessKeyID) > 0 || len(c.SecretAccessKey) > 0 {
+		if len(c.AccessKeyID) == 0 || len(c.SecretAccessKey) == 0 {
+			return nil, errors.New("s3 config: access key id and secret access key must be provided together")
+		}
+		cfg = cfg.WithCredentials(credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken))
+	} else if len(c.SessionToken) > 0 {
+		return nil, errors.New("s3 config: a session token requires an access key id and secret access key")
+	}
+	if len(c.Endpoint) > 0 {
+		cfg = cfg.WithEndpoint(c.Endpoint)
+	}
+	if c.ForcePathStyle {
+		cfg = cfg.WithS3ForcePathStyle(true)
+	}
+	if c.DisableSSL {
+		cfg = cfg.WithDisableSSL(true)
+	}
+	if c.HTTPClient != nil {
+		cfg = cfg.WithHTTPClient(c.HTTPClient)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		Profile:           c.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 config: error initializing session: %w", err)
+	}
+	return sess, nil
+}
+
+// Determines where downloaded objects are kept while they are parsed.
+type S3DownloadMode int
+
+const (
+	// Write the object to a local file in S3TransferOptions.Path and load it from there.
+	DownloadToFile S3DownloadMode = iota
+	// Download the object into memory with concurrent ranged requests, then parse it.
+	DownloadToMemory
+	// Parse the object while it is read from a single GetObject response. Nothing is buffered.
+	DownloadStreaming
+)
+
+// Optional settings for S3 transfers.
+type S3TransferOptions struct {
+	// Where downloads are kept. Only DownloadToFile needs a writable filesystem.
+	Mode S3DownloadMode
+	// Local directory downloaded objects are written to with DownloadToFile. Defaults to the working directory.
+	Path string
+	// Receives the number of bytes transferred. Defaults to no reporting.
+	Progress ProgressReporter
+}
+
 func CreateDataFrameFromAwsS3(path, item, bucket, region, awsAccessKey, awsSecretKey string) (DataFrame, error) {
+	// The downloader writes parts concurrently.
+	var numBytes atomic.Int64
+	progress := CallbackProgress{OnAdd: func(n int64) { numBytes.Add(n) }}
+
+	df, err := CreateDataFrameFromAwsS3WithOptions(path, item, bucket, region, awsAccessKey, awsSecretKey, S3TransferOptions{Progress: progress})
+	if err != nil {
+		return df, err
+	}
+
+	fmt.Println("Downloaded", filepath.Join(path, item), numBytes.Load(), "bytes")
+	return df, nil
+}
+
+// Same as CreateDataFrameFromAwsS3 with download progress reported to opts.Progress.
+func CreateDataFrameFromAwsS3WithOptions(path, item, bucket, region, awsAccessKey, awsSecretKey string, opts S3TransferOptions) (DataFrame, error) {
 	switch {
 	case !strings.Contains(item, ".csv"):
 		return DataFrame{}, errors.New("create dataframe from aws s3: only csv files are currently supported")
@@ -31,56 +135,104 @@ func CreateDataFrameFromAwsS3(path, item, bucket, region, awsAccessKey, awsSecre
 		return DataFrame{}, errors.New("create dataframe from aws s3: must provide a secret key")
 	}
 
-	// Set environment variables.
-	os.Setenv("AWS_ACCESS_KEY", awsAccessKey)
-	os.Setenv("AWS_SECRET_KEY", awsSecretKey)
+	cfg := S3Config{Region: region, AccessKeyID: awsAccessKey, SecretAccessKey: awsSecretKey}
+	opts.Path = path
 
-	// Create path.
-	filePath, err := filepath.Abs(path + item)
-	if err != nil {
-		return DataFrame{}, err
+	return CreateDataFrameFromS3(cfg, bucket, item, opts)
+}
+
+// Loads a csv object from S3 into a new DataFrame. By default the object is downloaded into
+// opts.Path first, in a file named after the last element of the key. Set opts.Mode to
+// DownloadToMemory or DownloadStreaming to avoid the local file.
+func CreateDataFrameFromS3(cfg S3Config, bucket, key string, opts S3TransferOptions) (DataFrame, error) {
+	switch {
+	case len(bucket) == 0:
+		return DataFrame{}, errors.New("create dataframe from aws s3: must provide a bucket name")
+	case len(key) == 0:
+		return DataFrame{}, errors.New("create dataframe from aws s3: must provide a file name")
 	}
 
-	// Create file.
-	file, err := os.Create(filePath)
+	sess, err := cfg.session()
 	if err != nil {
-		return DataFrame{}, fmt.Errorf("create dataframe from aws s3: error creating the file '%s'", err)
+		return DataFrame{}, fmt.Errorf("create dataframe from aws s3: %w", err)
 	}
-	defer file.Close()
 
-	// Initialize an AWS session.
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+	switch opts.Mode {
+	case DownloadToFile:
+	case DownloadToMemory:
+		df, err := downloadFrame(sess, bucket, key, opts.Progress)
+		if err != nil {
+			return DataFrame{}, fmt.Errorf("create dataframe from aws s3: %w", err)
+		}
+		return df, nil
+	case DownloadStreaming:
+		var df DataFrame
+		err := readObject(sess, bucket, key, opts.Progress, func(r io.Reader) error {
+			df, err = readFrame(r, LoadOptions{})
+			return err
+		})
+		if err != nil {
+			return DataFrame{}, fmt.Errorf("create dataframe from aws s3: %w", err)
+		}
+		return df, nil
+	default:
+		return DataFrame{}, fmt.Errorf("create dataframe from aws s3: unknown download mode %d", opts.Mode)
+	}
+
+	// Create file.
+	fileName := path.Base(key)
+	file, err := os.Create(filepath.Join(opts.Path, fileName))
 	if err != nil {
-		return DataFrame{}, errors.New("create dataframe from aws s3: error initializing session")
+		return DataFrame{}, fmt.Errorf("create dataframe from aws s3: error creating the file: %w", err)
 	}
+	defer file.Close()
 
 	// Download file from AWS
+	progress := progressOrSilent(opts.Progress)
+	progress.Start("downloading "+key, objectSize(sess, bucket, key), ProgressBytes)
+
 	downloader := s3manager.NewDownloader(sess)
 
-	numBytes, err := downloader.Download(file, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(item)})
+	_, err = downloader.Download(progressWriterAt{w: file, progress: progress}, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
 	if err != nil {
-		return DataFrame{}, fmt.Errorf("create dataframe from aws s3: error downloading file '%s'", err)
+		err = fmt.Errorf("create dataframe from aws s3: error downloading file: %w", err)
+		progress.Error(err)
+		return DataFrame{}, err
 	}
+	progress.Finish()
 
-	fmt.Println("Downloaded", file.Name(), numBytes, "bytes")
-
-	df := CreateDataFrame(path, item)
+	return CreateDataFrameWithOptions(opts.Path, fileName, LoadOptions{})
+}
 
-	return df, nil
+// Size of an S3 object in bytes, or -1 when it cannot be determined.
+func objectSize(sess *session.Session, bucket, key string) int64 {
+	head, err := s3.New(sess).HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil || head.ContentLength == nil {
+		return -1
+	}
+	return *head.ContentLength
 }
 
 func UploadFileToAwsS3(path, filename, bucket, region string) error {
+	return UploadFileToAwsS3WithOptions(path, filename, bucket, region, S3TransferOptions{})
+}
+
+// Same as UploadFileToAwsS3 with upload progress reported to opts.Progress.
+func UploadFileToAwsS3WithOptions(path, filename, bucket, region string, opts S3TransferOptions) error {
+	return UploadFileToS3(S3Config{Region: region}, path, filename, bucket, opts)
+}
+
+// Uploads a local file to S3. The file name is used as the object key.
+func UploadFileToS3(cfg S3Config, path, filename, bucket string, opts S3TransferOptions) error {
 	// Check user entries
-	if path[len(path)-1:] != "/" {
+	if len(path) > 0 && path[len(path)-1:] != "/" {
 		path = path + "/"
 	}
 
 	// Initialize an AWS session.
-	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	sess, err := cfg.session()
 	if err != nil {
-		return fmt.Errorf("upload file to s3: error initializing session '%s'", err)
+		return fmt.Errorf("upload file to s3: %w", err)
 	}
 
 	// Create an uploader with the session and default options
@@ -88,17 +240,395 @@ func UploadFileToAwsS3(path, filename, bucket, region string) error {
 
 	f, err := os.Open(path + filename)
 	if err != nil {
-		return errors.New("upload file to s3: failed to open file")
+		return fmt.Errorf("upload file to s3: failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	size := int64(-1)
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
 	}
+	progress := progressOrSilent(opts.Progress)
+	progress.Start("uploading "+filename, size, ProgressBytes)
 
 	// Upload the file to S3.
 	_, err = uploader.Upload(&s3manager.UploadInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(filename),
-		Body:   f,
+		Body:   progressReader{r: f, progress: progress},
+	})
+	if err != nil {
+		err = fmt.Errorf("upload file to s3: failed to upload file to aws s3: %w", err)
+	}
+	return finishProgress(progress, err)
+}
+
+// Serialization used when writing a DataFrame.
+type FileFormat int
+
+const (
+	FormatCSV FileFormat = iota
+	FormatTSV
+)
+
+func (f FileFormat) delimiter() rune {
+	if f == FormatTSV {
+		return '\t'
+	}
+	return ','
+}
+
+func (f FileFormat) contentType() string {
+	if f == FormatTSV {
+		return "text/tab-separated-values"
+	}
+	return "text/csv"
+}
+
+// Settings used by SaveDataFrameToS3.
+type S3SaveOptions struct {
+	Config S3Config
+	// Compress the object with gzip and set its Content-Encoding. The key is used as provided.
+	Gzip bool
+	// Content-Type of the object. Defaults to the type of the format.
+	ContentType string
+	// User defined metadata stored with the object.
+	Metadata map[string]string
+	// Object tags.
+	Tags map[string]string
+	// Server-side encryption algorithm, either "AES256" or "aws:kms".
+	ServerSideEncryption string
+	// KMS key used when ServerSideEncryption is "aws:kms". Defaults to the AWS managed key.
+	SSEKMSKeyID string
+	// Receives the number of rows written. Defaults to no reporting.
+	Progress ProgressReporter
+}
+
+// Streams the DataFrame straight into an S3 object without creating a local file.
+func (frame *DataFrame) SaveDataFrameToS3(bucket, key string, format FileFormat, opts S3SaveOptions) error {
+	switch {
+	case len(bucket) == 0:
+		return errors.New("save dataframe to s3: must provide a bucket name")
+	case len(key) == 0:
+		return errors.New("save dataframe to s3: must provide a key")
+	case format != FormatCSV && format != FormatTSV:
+		return fmt.Errorf("save dataframe to s3: unsupported format %d", format)
+	}
+
+	sess, err := opts.Config.session()
+	if err != nil {
+		return fmt.Errorf("save dataframe to s3: %w", err)
+	}
+
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(format.contentType()),
+	}
+	if len(opts.ContentType) > 0 {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.Gzip {
+		input.ContentEncoding = aws.String("gzip")
+	}
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+	if len(opts.Tags) > 0 {
+		tags := url.Values{}
+		for k, v := range opts.Tags {
+			tags.Set(k, v)
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+	if len(opts.ServerSideEncryption) > 0 {
+		input.ServerSideEncryption = aws.String(opts.ServerSideEncryption)
+	}
+	if len(opts.SSEKMSKeyID) > 0 {
+		input.SSEKMSKeyId = aws.String(opts.SSEKMSKeyID)
+	}
+
+	progress := progressOrSilent(opts.Progress)
+	progress.Start("saving "+key, int64(len(frame.FrameRecords)), ProgressRows)
+
+	compression := CompressionNone
+	if opts.Gzip {
+		compression = CompressionGzip
+	}
+	object := (&S3Storage{Bucket: bucket, sess: sess}).upload(input)
+	err = frame.writeCompressed(object, format, compression, false, progress)
+	if closeErr := closeStorageFile(object, err); preferCloseError(err, closeErr) {
+		err = fmt.Errorf("save dataframe to s3: error uploading: %w", closeErr)
+	} else if err != nil {
+		err = fmt.Errorf("save dataframe to s3: error writing the data: %w", err)
+	}
+	return finishProgress(progress, err)
+}
+
+func (frame *DataFrame) writeCompressed(w io.Writer, format FileFormat, compression Compression, bom bool, progress ProgressReporter) error {
+	cw, err := compress(w, compression)
+	if err != nil {
+		return err
+	}
+	if bom {
+		if _, err := cw.Write(utf8BOM); err != nil {
+			cw.Close()
+			return fmt.Errorf("error writing the byte order mark: %w", err)
+		}
+	}
+	if err := frame.writeCSV(cw, format.delimiter(), progress); err != nil {
+		// Closing releases the compressor, e.g. the goroutines of a zstd encoder.
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// Settings used to load many S3 objects at once.
+type S3ListOptions struct {
+	Config S3Config
+	// Only keys starting with Prefix are loaded.
+	Prefix string
+	// Optional glob matched against the full key with path.Match, e.g. "daily/2024-*.csv".
+	Pattern string
+	// Number of concurrent downloads. Defaults to 4.
+	Workers int
+	// Column added by ConcatFramesFromS3 holding the key each row came from. No column is added when empty.
+	SourceColumn string
+	// Receives the number of objects loaded. Defaults to no reporting.
+	Progress ProgressReporter
+}
+
+// Lists the keys in a bucket that start with prefix and match the optional glob pattern.
+// Every page of results is read and keys are returned in lexicographic order.
+func ListS3Objects(cfg S3Config, bucket, prefix, pattern string) ([]string, error) {
+	sess, err := cfg.session()
+	if err != nil {
+		return nil, fmt.Errorf("list s3 objects: %w", err)
+	}
+	return listObjects(sess, bucket, prefix, pattern)
+}
+
+func listObjects(sess *session.Session, bucket, prefix, pattern string) ([]string, error) {
+	if len(pattern) > 0 {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("list s3 objects: invalid pattern '%s': %w", pattern, err)
+		}
+	}
+
+	var keys []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+
+	err := s3.New(sess).ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+			// Skip folder placeholders.
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			if len(pattern) > 0 {
+				if ok, _ := path.Match(pattern, key); !ok {
+					continue
+				}
+			}
+			keys = append(keys, key)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list s3 objects: %w", err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Concurrently loads every csv object selected by opts into its own DataFrame. Frames are returned
+// in the same order as their keys, which are returned alongside them.
+func LoadFramesFromS3(bucket string, opts S3ListOptions) ([]DataFrame, []string, error) {
+	if len(bucket) == 0 {
+		return nil, nil, errors.New("load frames from s3: must provide a bucket name")
+	}
+
+	sess, err := opts.Config.session()
+	if err != nil {
+		return nil, nil, fmt.Errorf("load frames from s3: %w", err)
+	}
+
+	keys, err := listObjects(sess, bucket, opts.Prefix, opts.Pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load frames from s3: %w", err)
+	}
+
+	frames, err := loadObjects(sess, bucket, keys, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load frames from s3: %w", err)
+	}
+	return frames, keys, nil
+}
+
+// Loads every csv object selected by opts and stacks them into a single DataFrame in key order.
+// All objects must have the same columns in the same order.
+func ConcatFramesFromS3(bucket string, opts S3ListOptions) (DataFrame, error) {
+	frames, keys, err := LoadFramesFromS3(bucket, opts)
+	if err != nil {
+		return DataFrame{}, err
+	}
+	if len(frames) == 0 {
+		return DataFrame{}, errors.New("concat frames from s3: no objects found")
+	}
+
+	for i := range frames {
+		if len(opts.SourceColumn) > 0 {
+			addSourceColumn(&frames[i], opts.SourceColumn, keys[i])
+		}
+	}
+
+	df := frames[0]
+	for i := 1; i < len(frames); i++ {
+		df, err = df.ConcatFrames(&frames[i])
+		if err != nil {
+			return DataFrame{}, fmt.Errorf("concat frames from s3: '%s': %w", keys[i], err)
+		}
+	}
+	return df, nil
+}
+
+// Adds a column holding the same value for every row.
+func addSourceColumn(frame *DataFrame, column, value string) {
+	frame.NewField(column)
+	pos := frame.Headers[column]
+	for _, row := range frame.FrameRecords {
+		row.Data[pos] = value
+	}
+}
+
+type s3Job struct {
+	index int
+	key   string
+}
+
+type s3Result struct {
+	index int
+	frame DataFrame
+	err   error
+}
+
+// Downloads and parses objects with a bounded number of workers. Results are paired with their
+// keys by position, so the returned frames follow the order of keys.
+func loadObjects(sess *session.Session, bucket string, keys []string, opts S3ListOptions) ([]DataFrame, error) {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 4
+	}
+
+	progress := progressOrSilent(opts.Progress)
+	progress.Start("loading "+bucket+"/"+opts.Prefix, int64(len(keys)), ProgressFiles)
+
+	jobs := make(chan s3Job)
+	results := make(chan s3Result)
+	done := make(chan struct{})
+	defer close(done)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				df, err := downloadFrame(sess, bucket, job.key, nil)
+				select {
+				case results <- s3Result{index: job.index, frame: df, err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i, key := range keys {
+			select {
+			case jobs <- s3Job{index: i, key: key}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	frames := make([]DataFrame, len(keys))
+	for range keys {
+		res := <-results
+		if res.err != nil {
+			err := fmt.Errorf("'%s': %w", keys[res.index], res.err)
+			progress.Error(err)
+			return nil, err
+		}
+		frames[res.index] = res.frame
+		progress.Add(1)
+	}
+	progress.Finish()
+
+	return frames, nil
+}
+
+// Downloads an object into memory and parses it.
+func downloadFrame(sess *session.Session, bucket, key string, p ProgressReporter) (DataFrame, error) {
+	// Only look up the size when someone is listening.
+	size := int64(-1)
+	if p != nil {
+		size = objectSize(sess, bucket, key)
+	}
+	progress := progressOrSilent(p)
+	progress.Start("downloading "+key, size, ProgressBytes)
+
+	buf := aws.NewWriteAtBuffer(nil)
+
+	_, err := s3manager.NewDownloader(sess).Download(progressWriterAt{w: buf, progress: progress}, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		err = fmt.Errorf("error downloading file: %w", err)
+		progress.Error(err)
+		return DataFrame{}, err
+	}
+	progress.Finish()
+
+	return readFrame(bytes.NewReader(buf.Bytes()), LoadOptions{})
+}
+
+// Opens an object with GetObject and passes its body to read while it downloads.
+func readObject(sess *session.Session, bucket, key string, p ProgressReporter, read func(r io.Reader) error) error {
+	progress := progressOrSilent(p)
+
+	out, err := s3.New(sess).GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		err = fmt.Errorf("error downloading file: %w", err)
+		progress.Start("downloading "+key, -1, ProgressBytes)
+		progress.Error(err)
+		return err
+	}
+	defer out.Body.Close()
+
+	size := int64(-1)
+	if out.ContentLength != nil {
+		size = *out.ContentLength
+	}
+	progress.Start("downloading "+key, size, ProgressBytes)
+	return finishProgress(progress, read(progressReader{r: out.Body, progress: progress}))
+}
+
+// Streams the rows of a csv object to c as StreamingRecord values while the object downloads,
+// the same way Stream does for local files. The channel is closed when the function returns.
+func StreamFromS3(cfg S3Config, bucket, key string, c chan StreamingRecord) error {
+	defer close(c)
+
+	sess, err := cfg.session()
+	if err != nil {
+		return fmt.Errorf("stream from aws s3: %w", err)
+	}
+
+	err = readObject(sess, bucket, key, nil, func(r io.Reader) error {
+		return streamCSV(r, LoadOptions{}, c)
 	})
 	if err != nil {
-		return errors.New("upload file to s3: failed to upload file to aws s3")
+		return fmt.Errorf("stream from aws s3: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,131 @@
+package dataframe
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression applied to csv data.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+	// Only supported when reading.
+	CompressionBzip2
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionBzip2:
+		return "bzip2"
+	default:
+		return "none"
+	}
+}
+
+// File extension for the compression, including the dot.
+func (c Compression) extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	case CompressionBzip2:
+		return ".bz2"
+	default:
+		return ""
+	}
+}
+
+// Compression implied by the extension of a file name.
+func compressionFromName(fileName string) Compression {
+	lower := strings.ToLower(fileName)
+	for _, c := range []Compression{CompressionGzip, CompressionZstd, CompressionBzip2} {
+		if strings.HasSuffix(lower, c.extension()) {
+			return c
+		}
+	}
+	if strings.HasSuffix(lower, ".gzip") {
+		return CompressionGzip
+	}
+	if strings.HasSuffix(lower, ".zstd") {
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	// Follows the block size digit: the magic of the first block, or of the end of an empty stream.
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// Reports whether data starts with a bzip2 stream header. Only "BZh" could also be the start of text.
+func isBzip2(head []byte) bool {
+	if len(head) < 10 || !bytes.HasPrefix(head, bzip2Magic) || head[3] < '1' || head[3] > '9' {
+		return false
+	}
+	return bytes.Equal(head[4:10], bzip2BlockMagic) || bytes.Equal(head[4:10], bzip2EndMagic)
+}
+
+// Detects compressed data from its leading magic bytes and returns a reader of the
+// decompressed data. Uncompressed data is passed through. Close releases the decoder.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(10)
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error reading gzip data: %w", err)
+		}
+		return gz, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error reading zstd data: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	case isBzip2(head):
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+// Wraps w so everything written is compressed. Close flushes the compressed data but does not close w.
+func compress(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("writing %s compressed files is not supported", c)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
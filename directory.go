@@ -0,0 +1,266 @@
+package dataframe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// How the columns of several files are combined into one DataFrame.
+type SchemaMode int
+
+const (
+	// Every file must have the same columns. The order of the columns may differ.
+	SchemaIdentical SchemaMode = iota
+	// Keeps every column found in any file. Rows from files without a column get an empty value.
+	SchemaUnion
+	// Keeps only the columns found in every file.
+	SchemaIntersection
+)
+
+// Settings used by the directory and glob loaders.
+type LoadFilesOptions struct {
+	LoadFramesOptions
+	// Searches subdirectories as well. Only used by LoadDirectory and UnionDirectory.
+	Recursive bool
+	// How the columns of the files are combined by UnionDirectory and UnionGlob.
+	Schema SchemaMode
+	// Column added by UnionDirectory and UnionGlob holding the file each row came from.
+	// No column is added when empty.
+	SourceColumn string
+}
+
+// Names of the files in dir whose base name matches pattern, such as "*.csv", in lexicographic order.
+// An empty pattern matches every file.
+func FindFiles(dir, pattern string, recursive bool, storage Storage) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("find files: %w", err)
+	}
+
+	prefix := storageName(dir, "")
+	if prefix == "." {
+		prefix = ""
+	} else if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	names, err := storageOrLocal(storage).List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("find files: %w", err)
+	}
+
+	var files []string
+	for _, name := range names {
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, "./"), strings.TrimPrefix(prefix, "./"))
+		if !recursive && strings.Contains(rel, "/") {
+			continue
+		}
+		if len(pattern) > 0 {
+			if ok, _ := path.Match(pattern, path.Base(name)); !ok {
+				continue
+			}
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// Names of the files matching a glob such as "exports/2024-*/sales_*.csv", in lexicographic order.
+// Every part of the name is matched with path.Match, so "*" does not cross directories.
+func FindGlob(pattern string, storage Storage) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("find files: %w", err)
+	}
+
+	// List everything below the directory that comes before the first wildcard.
+	prefix := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		prefix = pattern[:i]
+	}
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		prefix = prefix[:i+1]
+	} else {
+		prefix = ""
+	}
+
+	names, err := storageOrLocal(storage).List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("find files: %w", err)
+	}
+
+	var files []string
+	for _, name := range names {
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "./"), strings.TrimPrefix(name, "./")); ok {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// Concurrently loads every file in dir whose name matches pattern. Results are in file name order.
+func LoadDirectory(ctx context.Context, dir, pattern string, opts LoadFilesOptions) ([]FrameResult, error) {
+	files, err := FindFiles(dir, pattern, opts.Recursive, opts.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return loadMatchedFiles(ctx, files, fmt.Sprintf("no files matching '%s' in '%s'", pattern, dir), opts)
+}
+
+// Concurrently loads every file matching the glob. Results are in file name order.
+func LoadGlob(ctx context.Context, pattern string, opts LoadFilesOptions) ([]FrameResult, error) {
+	files, err := FindGlob(pattern, opts.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return loadMatchedFiles(ctx, files, fmt.Sprintf("no files matching '%s'", pattern), opts)
+}
+
+func loadMatchedFiles(ctx context.Context, files []string, notFound string, opts LoadFilesOptions) ([]FrameResult, error) {
+	if len(files) == 0 {
+		return nil, errors.New("load files: " + notFound)
+	}
+	return loadFiles(ctx, files, opts.LoadFramesOptions, func(ctx context.Context, file string, load LoadOptions) (DataFrame, error) {
+		return loadFrame(ctx, file, path.Base(file), load)
+	})
+}
+
+// Loads every matching file in dir into a single DataFrame with the columns combined as set in opts.Schema.
+// With opts.CollectErrors the files that loaded are combined and returned along with the errors of the others.
+func UnionDirectory(ctx context.Context, dir, pattern string, opts LoadFilesOptions) (DataFrame, error) {
+	results, err := LoadDirectory(ctx, dir, pattern, opts)
+	return unionResults(ctx, results, err, opts)
+}
+
+// Loads every file matching the glob into a single DataFrame with the columns combined as set in opts.Schema.
+// With opts.CollectErrors the files that loaded are combined and returned along with the errors of the others.
+func UnionGlob(ctx context.Context, pattern string, opts LoadFilesOptions) (DataFrame, error) {
+	results, err := LoadGlob(ctx, pattern, opts)
+	return unionResults(ctx, results, err, opts)
+}
+
+// Combines the files that loaded. Load errors are only tolerated when they were collected per file.
+func unionResults(ctx context.Context, results []FrameResult, loadErr error, opts LoadFilesOptions) (DataFrame, error) {
+	if loadErr != nil && (!opts.CollectErrors || results == nil || ctx.Err() != nil) {
+		return DataFrame{}, loadErr
+	}
+
+	var frames []DataFrame
+	var sources []string
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		frames = append(frames, result.Frame)
+		sources = append(sources, result.File)
+	}
+	if len(frames) == 0 {
+		return DataFrame{}, loadErr
+	}
+
+	df, err := UnionFrames(frames, sources, opts.Schema, opts.SourceColumn)
+	if err != nil {
+		return DataFrame{}, errors.Join(loadErr, err)
+	}
+	return df, loadErr
+}
+
+// Stacks the rows of several DataFrames into one. When sourceColumn is set, a column with that name
+// holds the entry of sources matching the frame each row came from.
+func UnionFrames(frames []DataFrame, sources []string, mode SchemaMode, sourceColumn string) (DataFrame, error) {
+	if len(sourceColumn) > 0 && len(sources) != len(frames) {
+		return DataFrame{}, errors.New("union frames: a source is required for every frame")
+	}
+
+	columns, err := unionColumns(frames, sources, mode)
+	if err != nil {
+		return DataFrame{}, err
+	}
+	if len(sourceColumn) > 0 {
+		if slices.Contains(columns, sourceColumn) {
+			return DataFrame{}, fmt.Errorf("union frames: source column '%s' already exists", sourceColumn)
+		}
+		columns = append(columns, sourceColumn)
+	}
+
+	rows := 0
+	for _, frame := range frames {
+		rows += len(frame.FrameRecords)
+	}
+	union := CreateNewDataFrame(columns)
+	union.FrameRecords = make([]Record, 0, rows)
+
+	for i, frame := range frames {
+		positions := make([]int, len(columns))
+		for c, col := range columns {
+			pos, ok := frame.Headers[col]
+			if !ok {
+				pos = -1
+			}
+			positions[c] = pos
+		}
+
+		for _, row := range frame.FrameRecords {
+			data := make([]string, len(columns))
+			for c, pos := range positions {
+				if pos >= 0 && pos < len(row.Data) {
+					data[c] = row.Data[pos]
+				}
+			}
+			if len(sourceColumn) > 0 {
+				data[len(columns)-1] = sources[i]
+			}
+			union.FrameRecords = append(union.FrameRecords, Record{Data: data})
+		}
+	}
+	return union, nil
+}
+
+// Columns of the combined frame, in the order they first appear.
+func unionColumns(frames []DataFrame, sources []string, mode SchemaMode) ([]string, error) {
+	if len(frames) == 0 {
+		return []string{}, nil
+	}
+
+	name := func(i int) string {
+		if i < len(sources) {
+			return sources[i]
+		}
+		return fmt.Sprintf("frame %d", i+1)
+	}
+
+	columns := frames[0].Columns()
+	for i, frame := range frames[1:] {
+		switch mode {
+		case SchemaUnion:
+			for _, col := range frame.Columns() {
+				if !slices.Contains(columns, col) {
+					columns = append(columns, col)
+				}
+			}
+		case SchemaIntersection:
+			kept := columns[:0:0]
+			for _, col := range columns {
+				if _, ok := frame.Headers[col]; ok {
+					kept = append(kept, col)
+				}
+			}
+			columns = kept
+		default:
+			if len(frame.Headers) != len(columns) {
+				return nil, fmt.Errorf("union frames: %s has columns %v but %s has %v", name(i+1), frame.Columns(), name(0), columns)
+			}
+			for _, col := range columns {
+				if _, ok := frame.Headers[col]; !ok {
+					return nil, fmt.Errorf("union frames: %s has columns %v but %s has %v", name(i+1), frame.Columns(), name(0), columns)
+				}
+			}
+		}
+	}
+	return columns, nil
+}
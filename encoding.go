@@ -0,0 +1,137 @@
+package dataframe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Character encoding of csv data. Data is always converted to UTF-8 when loaded.
+type Encoding int
+
+const (
+	// Detects UTF-8 and UTF-16 byte order marks. Data without a byte order mark is read as UTF-8,
+	// unless the start of the data is not valid UTF-8 in which case Windows-1252 is assumed. When
+	// invalid UTF-8 only turns up later, the data from that point on is read as Windows-1252.
+	EncodingAuto Encoding = iota
+	EncodingUTF8
+	EncodingUTF16LE
+	EncodingUTF16BE
+	EncodingWindows1252
+	EncodingISO88591
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case EncodingUTF8:
+		return "utf-8"
+	case EncodingUTF16LE:
+		return "utf-16le"
+	case EncodingUTF16BE:
+		return "utf-16be"
+	case EncodingWindows1252:
+		return "windows-1252"
+	case EncodingISO88591:
+		return "iso-8859-1"
+	default:
+		return "auto"
+	}
+}
+
+// Number of bytes inspected when guessing the encoding of data without a byte order mark.
+const encodingSniffSize = 4096
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// Returns a reader that converts r from the encoding to UTF-8. Byte order marks are removed.
+func decode(r io.Reader, enc Encoding) (io.Reader, error) {
+	var decoder *encoding.Decoder
+
+	switch enc {
+	case EncodingAuto:
+		br := bufio.NewReaderSize(r, encodingSniffSize)
+		head, _ := br.Peek(encodingSniffSize)
+
+		// A byte order mark takes precedence over the fallback.
+		var fallback transform.Transformer = &utf8Fallback{fallback: charmap.Windows1252.NewDecoder()}
+		if !validUTF8Prefix(head, len(head) < encodingSniffSize) {
+			fallback = charmap.Windows1252.NewDecoder()
+		}
+		return transform.NewReader(br, unicode.BOMOverride(fallback)), nil
+	case EncodingUTF8:
+		decoder = unicode.UTF8BOM.NewDecoder()
+	case EncodingUTF16LE:
+		decoder = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+	case EncodingUTF16BE:
+		decoder = unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder()
+	case EncodingWindows1252:
+		decoder = charmap.Windows1252.NewDecoder()
+	case EncodingISO88591:
+		decoder = charmap.ISO8859_1.NewDecoder()
+	default:
+		return nil, fmt.Errorf("unknown encoding: %d", enc)
+	}
+	return transform.NewReader(r, decoder), nil
+}
+
+// Reports whether data is valid UTF-8. When the data was cut off, a trailing partial character is ignored.
+func validUTF8Prefix(data []byte, complete bool) bool {
+	if utf8.Valid(data) {
+		return true
+	}
+	if complete {
+		return false
+	}
+	for i := 1; i < utf8.UTFMax && i < len(data); i++ {
+		if utf8.Valid(data[:len(data)-i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Passes UTF-8 through until the first byte that is not valid UTF-8 and decodes the rest of the data
+// with the fallback, so characters after the sniffed start of a file are not replaced with U+FFFD.
+type utf8Fallback struct {
+	fallback transform.Transformer
+	switched bool
+}
+
+func (t *utf8Fallback) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	if t.switched {
+		return t.fallback.Transform(dst, src, atEOF)
+	}
+
+	nDst, nSrc := 0, 0
+	for nSrc < len(src) {
+		size := 1
+		if src[nSrc] >= utf8.RuneSelf {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			var r rune
+			if r, size = utf8.DecodeRune(src[nSrc:]); r == utf8.RuneError && size == 1 {
+				t.switched = true
+				n, m, err := t.fallback.Transform(dst[nDst:], src[nSrc:], atEOF)
+				return nDst + n, nSrc + m, err
+			}
+		}
+		if nDst+size > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], src[nSrc:nSrc+size])
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+func (t *utf8Fallback) Reset() {
+	t.switched = false
+	t.fallback.Reset()
+}
@@ -0,0 +1,378 @@
+package dataframe
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// How padding is removed from fixed-width values when loading.
+type TrimMode int
+
+const (
+	TrimBoth TrimMode = iota
+	TrimNone
+	TrimLeading
+	TrimTrailing
+)
+
+// Position of values narrower than their column when saving.
+type Alignment int
+
+const (
+	AlignLeft Alignment = iota
+	AlignRight
+)
+
+// A single column in a fixed-width file. Positions and widths are counted in characters.
+type FixedWidthColumn struct {
+	Name string
+	// Position of the first character, starting at 1.
+	Start int
+	Width int
+	// Padding removed when loading. Defaults to trimming both sides.
+	Trim TrimMode
+	// Characters removed by Trim. Defaults to spaces.
+	Cutset string
+	// Alignment used when saving. Defaults to left aligned.
+	Align Alignment
+	// Character used to pad values when saving. Defaults to a space.
+	Pad rune
+}
+
+// Layout of a fixed-width file.
+type FixedWidthSpec struct {
+	Columns []FixedWidthColumn
+	// Lines at the start of the file, such as a title or header, that are skipped when loading.
+	SkipLines int
+	// Leaves out lines that are shorter than the spec instead of loading their partial values.
+	// Short lines are reported either way.
+	SkipShortLines bool
+	// Values wider than their column are cut off when saving instead of returning an error.
+	Truncate bool
+	// Written after every line. Defaults to "\n". Both "\n" and "\r\n" are accepted when loading.
+	LineEnding string
+}
+
+// A line that ended before the last column in the spec.
+type ShortLine struct {
+	// Line number in the file, starting at 1.
+	Line int
+	// Length of the line in characters.
+	Length int
+}
+
+func (spec FixedWidthSpec) validate() error {
+	if len(spec.Columns) == 0 {
+		return errors.New("fixed width spec: no columns provided")
+	}
+
+	seen := make(map[string]bool)
+	for _, col := range spec.Columns {
+		if col.Start < 1 || col.Width < 1 {
+			return fmt.Errorf("fixed width spec: column '%s' must have a start of at least 1 and a positive width", col.Name)
+		}
+		if seen[col.Name] {
+			return fmt.Errorf("fixed width spec: column '%s' is defined more than once", col.Name)
+		}
+		seen[col.Name] = true
+	}
+	return nil
+}
+
+// Length in characters a line needs to hold every column.
+func (spec FixedWidthSpec) lineLength() int {
+	length := 0
+	for _, col := range spec.Columns {
+		if end := col.Start - 1 + col.Width; end > length {
+			length = end
+		}
+	}
+	return length
+}
+
+func (col FixedWidthColumn) trim(val string) string {
+	cutset := col.Cutset
+	if len(cutset) == 0 {
+		cutset = " "
+	}
+
+	switch col.Trim {
+	case TrimNone:
+		return val
+	case TrimLeading:
+		return strings.TrimLeft(val, cutset)
+	case TrimTrailing:
+		return strings.TrimRight(val, cutset)
+	default:
+		return strings.Trim(val, cutset)
+	}
+}
+
+// Generate a new DataFrame sourced from a fixed-width text file. Lines that are too short for the spec
+// are returned together with the frame. Storage, encoding, compression and progress follow opts.
+func LoadFixedWidth(path, fileName string, spec FixedWidthSpec, opts LoadOptions) (DataFrame, []ShortLine, error) {
+	progress := progressOrSilent(opts.Progress)
+	storage := storageOrLocal(opts.Storage)
+	name := storageName(path, fileName)
+
+	file, err := storage.Open(name)
+	if err != nil {
+		return DataFrame{}, nil, fmt.Errorf("error opening file: please ensure the path and filename are correct: %w", err)
+	}
+	defer file.Close()
+
+	size := int64(-1)
+	if opts.Progress != nil {
+		if info, err := storage.Stat(name); err == nil {
+			size = info.Size
+		}
+	}
+	progress.Start("loading "+fileName, size, ProgressBytes)
+
+	s := []Record{}
+	headers, short, err := readFixedWidth(progressReader{r: file, progress: progress}, spec, opts, func(headers map[string]int, record []string) error {
+		s = append(s, Record{Data: record})
+		return nil
+	})
+	if err := finishProgress(progress, err); err != nil {
+		return DataFrame{}, short, err
+	}
+	return DataFrame{FrameRecords: s, Headers: headers}, short, nil
+}
+
+// Stream rows of a fixed-width text file to c. The channel is closed when done.
+// Lines that are too short for the spec are returned once the whole file was read.
+func StreamFixedWidth(path, fileName string, spec FixedWidthSpec, c chan StreamingRecord, opts LoadOptions) ([]ShortLine, error) {
+	defer close(c)
+
+	progress := progressOrSilent(opts.Progress)
+	storage := storageOrLocal(opts.Storage)
+	name := storageName(path, fileName)
+
+	file, err := storage.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the file: please ensure the path and filename are correct: %w", err)
+	}
+	defer file.Close()
+
+	size := int64(-1)
+	if opts.Progress != nil {
+		if info, err := storage.Stat(name); err == nil {
+			size = info.Size
+		}
+	}
+	progress.Start("loading "+fileName, size, ProgressBytes)
+
+	_, short, err := readFixedWidth(progressReader{r: file, progress: progress}, spec, opts, func(headers map[string]int, record []string) error {
+		c <- StreamingRecord{Data: record, Headers: headers}
+		return nil
+	})
+	return short, finishProgress(progress, err)
+}
+
+// Splits every line of fixed-width data into values and passes them to emit, the same way readCSV does.
+func readFixedWidth(r io.Reader, spec FixedWidthSpec, opts LoadOptions, emit func(headers map[string]int, record []string) error) (map[string]int, []ShortLine, error) {
+	if err := spec.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := decompress(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer data.Close()
+
+	text, err := decode(data, opts.Encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := make(map[string]int)
+	for i, col := range spec.Columns {
+		headers[col.Name] = i
+	}
+	lineLength := spec.lineLength()
+
+	selector, err := newRowSelector(headers, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var short []ShortLine
+	scanner := bufio.NewScanner(text)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for lineNumber := 1; !selector.done() && scanner.Scan(); lineNumber++ {
+		if lineNumber <= spec.SkipLines {
+			continue
+		}
+		line := []rune(strings.TrimSuffix(scanner.Text(), "\r"))
+
+		if len(line) < lineLength {
+			// Blank lines at the end of a file are common and not worth reporting.
+			if len(line) == 0 {
+				continue
+			}
+			short = append(short, ShortLine{Line: lineNumber, Length: len(line)})
+			if spec.SkipShortLines {
+				continue
+			}
+		}
+
+		record := make([]string, len(spec.Columns))
+		for i, col := range spec.Columns {
+			start := col.Start - 1
+			if start >= len(line) {
+				continue
+			}
+			end := start + col.Width
+			if end > len(line) {
+				end = len(line)
+			}
+			record[i] = col.trim(string(line[start:end]))
+		}
+
+		record, ok := selector.selectRow(record)
+		if !ok {
+			continue
+		}
+		if err := emit(selector.headers, record); err != nil {
+			return nil, short, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, short, fmt.Errorf("error reading the lines: %w", err)
+	}
+	return selector.headers, short, nil
+}
+
+// Save the DataFrame to a fixed-width text file. Every column in the spec must exist in the frame
+// and columns may not overlap. Gaps between columns are filled with spaces.
+func (frame *DataFrame) SaveFixedWidth(path, fileName string, spec FixedWidthSpec, opts SaveOptions) error {
+	if err := spec.validate(); err != nil {
+		return err
+	}
+	if err := frame.checkFixedWidthColumns(spec); err != nil {
+		return err
+	}
+
+	compression := opts.Compression
+	if compression == CompressionNone {
+		compression = compressionFromName(fileName)
+	} else if compressionFromName(fileName) != compression {
+		fileName += compression.extension()
+	}
+	progress := progressOrSilent(opts.Progress)
+
+	file, err := storageOrLocal(opts.Storage).Create(storageName(path, fileName))
+	if err != nil {
+		return fmt.Errorf("error creating the fixed width file: %w", err)
+	}
+
+	progress.Start("saving "+fileName, int64(len(frame.FrameRecords)), ProgressRows)
+
+	err = frame.writeFixedWidth(file, spec, compression, opts.WriteBOM, progress)
+	if closeErr := closeStorageFile(file, err); preferCloseError(err, closeErr) {
+		err = fmt.Errorf("error closing the fixed width file: %w", closeErr)
+	}
+	return finishProgress(progress, err)
+}
+
+func (frame *DataFrame) checkFixedWidthColumns(spec FixedWidthSpec) error {
+	for _, col := range spec.Columns {
+		if _, ok := frame.Headers[col.Name]; !ok {
+			return fmt.Errorf("fixed width spec: column '%s' does not exist in the dataframe", col.Name)
+		}
+	}
+
+	for i, a := range spec.Columns {
+		for _, b := range spec.Columns[i+1:] {
+			if a.Start < b.Start+b.Width && b.Start < a.Start+a.Width {
+				return fmt.Errorf("fixed width spec: columns '%s' and '%s' overlap", a.Name, b.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (frame *DataFrame) writeFixedWidth(out io.Writer, spec FixedWidthSpec, compression Compression, bom bool, progress ProgressReporter) error {
+	cw, err := compress(out, compression)
+	if err != nil {
+		return err
+	}
+	if err := frame.writeFixedWidthLines(cw, spec, bom, progress); err != nil {
+		// Closing releases the compressor, e.g. the goroutines of a zstd encoder.
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+func (frame *DataFrame) writeFixedWidthLines(out io.Writer, spec FixedWidthSpec, bom bool, progress ProgressReporter) error {
+	w := bufio.NewWriter(out)
+
+	if bom {
+		w.Write(utf8BOM)
+	}
+
+	lineEnding := spec.LineEnding
+	if len(lineEnding) == 0 {
+		lineEnding = "\n"
+	}
+
+	line := make([]rune, spec.lineLength())
+	for r, row := range frame.FrameRecords {
+		for i := range line {
+			line[i] = ' '
+		}
+
+		for _, col := range spec.Columns {
+			val, err := fixedWidthValue(col, row.Val(col.Name, frame.Headers), spec.Truncate)
+			if err != nil {
+				return fmt.Errorf("error writing row %d: %w", r+1, err)
+			}
+			copy(line[col.Start-1:], val)
+		}
+
+		if _, err := w.WriteString(string(line) + lineEnding); err != nil {
+			return fmt.Errorf("error writing the fixed width records: %w", err)
+		}
+		progress.Add(1)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing the fixed width records: %w", err)
+	}
+	return nil
+}
+
+// Pads the value to the width of the column.
+func fixedWidthValue(col FixedWidthColumn, val string, truncate bool) ([]rune, error) {
+	runes := []rune(val)
+	if len(runes) > col.Width {
+		if !truncate {
+			return nil, fmt.Errorf("value '%s' is longer than the %d characters of column '%s'", val, col.Width, col.Name)
+		}
+		runes = runes[:col.Width]
+	}
+
+	pad := col.Pad
+	if pad == 0 || !utf8.ValidRune(pad) {
+		pad = ' '
+	}
+
+	padded := make([]rune, col.Width)
+	offset := 0
+	if col.Align == AlignRight {
+		offset = col.Width - len(runes)
+	}
+	for i := range padded {
+		padded[i] = pad
+	}
+	copy(padded[offset:], runes)
+	return padded, nil
+}
@@ -0,0 +1,733 @@
+package dataframe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Query that is only run when it is collected. Every step adds to a plan that is optimized first:
+// filters and column selections are moved as close to the data as possible and handed to the csv
+// reader, so rows and columns that are not needed are never stored. Adjacent selections are merged.
+// A LazyFrame can be reused and extended; every method returns a new LazyFrame.
+type LazyFrame struct {
+	plan planNode
+	err  error
+}
+
+// Lazy query over the rows of an existing DataFrame. Rows are copied once, when the query is collected.
+func (frame DataFrame) Lazy() LazyFrame {
+	return LazyFrame{plan: &scanNode{frame: &frame}}
+}
+
+// Lazy query over a csv file. The header is read when the query is explained or collected, and the
+// rows are read while the query is collected. The .csv extension is added when missing.
+func ScanCSV(path, fileName string, opts LoadOptions) LazyFrame {
+	return LazyFrame{plan: &scanNode{path: path, fileName: fileName, opts: opts}}
+}
+
+func (l LazyFrame) with(n planNode) LazyFrame {
+	if l.err != nil {
+		return l
+	}
+	return LazyFrame{plan: n}
+}
+
+func (l LazyFrame) fail(err error) LazyFrame {
+	if l.err != nil {
+		return l
+	}
+	return LazyFrame{err: err}
+}
+
+// Keeps the rows for which keep returns true. List the columns keep reads so the filter can be moved
+// past joins; without them it stays above any join.
+func (l LazyFrame) Filter(keep func(row StreamingRecord) bool, columns ...string) LazyFrame {
+	desc := "custom"
+	if len(columns) > 0 {
+		desc = fmt.Sprintf("custom %v", columns)
+	}
+	return l.with(&filterNode{input: l.plan, filter: lazyFilter{desc: desc, columns: columns, keep: keep}})
+}
+
+// Keeps the rows whose field matches one of the values.
+func (l LazyFrame) Filtered(fieldName string, value ...string) LazyFrame {
+	return l.with(&filterNode{input: l.plan, filter: lazyFilter{
+		desc:    fmt.Sprintf("%s in %v", fieldName, value),
+		columns: []string{fieldName},
+		keep: func(row StreamingRecord) bool {
+			return slices.Contains(value, row.Val(fieldName))
+		},
+	}})
+}
+
+// Keeps the rows whose field matches none of the values.
+func (l LazyFrame) Exclude(fieldName string, value ...string) LazyFrame {
+	return l.with(&filterNode{input: l.plan, filter: lazyFilter{
+		desc:    fmt.Sprintf("%s not in %v", fieldName, value),
+		columns: []string{fieldName},
+		keep: func(row StreamingRecord) bool {
+			return !slices.Contains(value, row.Val(fieldName))
+		},
+	}})
+}
+
+// Keeps the rows whose numerical field is greater than or equal to value. Values that are not numbers are left out.
+func (l LazyFrame) GreaterThanOrEqualTo(fieldName string, value float64) LazyFrame {
+	return l.with(&filterNode{input: l.plan, filter: lazyFilter{
+		desc:    fmt.Sprintf("%s >= %v", fieldName, value),
+		columns: []string{fieldName},
+		keep: func(row StreamingRecord) bool {
+			val, err := strconv.ParseFloat(row.Val(fieldName), 64)
+			return err == nil && val >= value
+		},
+	}})
+}
+
+// Keeps the rows whose numerical field is less than or equal to value. Values that are not numbers are left out.
+func (l LazyFrame) LessThanOrEqualTo(fieldName string, value float64) LazyFrame {
+	return l.with(&filterNode{input: l.plan, filter: lazyFilter{
+		desc:    fmt.Sprintf("%s <= %v", fieldName, value),
+		columns: []string{fieldName},
+		keep: func(row StreamingRecord) bool {
+			val, err := strconv.ParseFloat(row.Val(fieldName), 64)
+			return err == nil && val <= value
+		},
+	}})
+}
+
+// Keeps only the given columns, in the given order.
+func (l LazyFrame) Select(columns ...string) LazyFrame {
+	if len(columns) == 0 {
+		return l.fail(errors.New("lazy select: must provide at least one column"))
+	}
+	return l.with(&projectNode{input: l.plan, columns: slices.Clone(columns)})
+}
+
+// Sorts the rows as DataFrame.Sort does.
+func (l LazyFrame) Sort(fieldName string, ascending bool) LazyFrame {
+	return l.with(&sortNode{input: l.plan, column: fieldName, ascending: ascending})
+}
+
+// Keeps the first n rows.
+func (l LazyFrame) Limit(n int) LazyFrame {
+	if n < 1 {
+		return l.fail(errors.New("lazy limit: must keep at least one row"))
+	}
+	return l.with(&limitNode{input: l.plan, n: n})
+}
+
+// Keeps the rows whose key is found in both queries and adds the columns of right, as DataFrame.InnerMerge does.
+func (l LazyFrame) Join(right LazyFrame, primaryKey string) LazyFrame {
+	if right.err != nil {
+		return l.fail(right.err)
+	}
+	return l.with(&joinNode{left: l.plan, right: right.plan, key: primaryKey, inner: true})
+}
+
+// Keeps every row and adds the columns of right where the key matches, as DataFrame.Merge does.
+// Every column of right is added when no columns are provided.
+func (l LazyFrame) LeftJoin(right LazyFrame, primaryKey string, columns ...string) LazyFrame {
+	if right.err != nil {
+		return l.fail(right.err)
+	}
+	return l.with(&joinNode{left: l.plan, right: right.plan, key: primaryKey, columns: slices.Clone(columns)})
+}
+
+// Runs the optimized plan and returns the result as a new DataFrame.
+func (l LazyFrame) Collect(ctx context.Context) (DataFrame, error) {
+	plan, err := l.optimized()
+	if err != nil {
+		return DataFrame{}, err
+	}
+	return execute(ctx, plan)
+}
+
+// Describes the optimized plan, one step per line with the inputs of a step indented below it.
+func (l LazyFrame) Explain() (string, error) {
+	plan, err := l.optimized()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	var write func(n planNode, depth int)
+	write = func(n planNode, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(n.describe())
+		b.WriteString("\n")
+		for _, input := range n.inputs() {
+			write(input, depth+1)
+		}
+	}
+	write(plan, 0)
+	return b.String(), nil
+}
+
+func (l LazyFrame) optimized() (planNode, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	plan, _, err := prepare(l.plan)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the rules until none of them changes the plan.
+	for changed := true; changed; {
+		plan, changed = rewrite(plan)
+	}
+	return plan, nil
+}
+
+// A step in a query plan. Nodes are never changed once created, so plans can be shared.
+type planNode interface {
+	describe() string
+	inputs() []planNode
+}
+
+type lazyFilter struct {
+	desc string
+	// Columns read by keep. Nil when unknown.
+	columns []string
+	keep    func(row StreamingRecord) bool
+}
+
+// Reads a DataFrame or csv file. Filters, column selection and a limit are applied while reading,
+// in that order.
+type scanNode struct {
+	frame    *DataFrame
+	path     string
+	fileName string
+	opts     LoadOptions
+
+	// Columns of the source, read from the file for csv scans.
+	header  []string
+	filters []lazyFilter
+	columns []string
+	limit   int
+}
+
+type filterNode struct {
+	input  planNode
+	filter lazyFilter
+}
+
+type projectNode struct {
+	input   planNode
+	columns []string
+}
+
+type sortNode struct {
+	input     planNode
+	column    string
+	ascending bool
+}
+
+type limitNode struct {
+	input planNode
+	n     int
+}
+
+type joinNode struct {
+	left, right planNode
+	key         string
+	inner       bool
+	// Columns of right added by a left join. Nil adds every column.
+	columns []string
+}
+
+func (n *scanNode) describe() string {
+	var b strings.Builder
+	if n.frame != nil {
+		fmt.Fprintf(&b, "Scan frame (%d rows)", len(n.frame.FrameRecords))
+	} else {
+		fmt.Fprintf(&b, "Scan csv %s", storageName(n.path, csvFileName(n.fileName)))
+	}
+	if n.columns != nil {
+		fmt.Fprintf(&b, " columns=%v", n.columns)
+	}
+	if len(n.filters) > 0 {
+		descs := make([]string, len(n.filters))
+		for i, f := range n.filters {
+			descs[i] = f.desc
+		}
+		fmt.Fprintf(&b, " filter=[%s]", strings.Join(descs, " AND "))
+	}
+	if n.limit > 0 {
+		fmt.Fprintf(&b, " limit=%d", n.limit)
+	}
+	return b.String()
+}
+
+func (n *filterNode) describe() string  { return "Filter " + n.filter.desc }
+func (n *projectNode) describe() string { return fmt.Sprintf("Select %v", n.columns) }
+func (n *limitNode) describe() string   { return fmt.Sprintf("Limit %d", n.n) }
+
+func (n *sortNode) describe() string {
+	if n.ascending {
+		return "Sort " + n.column + " ascending"
+	}
+	return "Sort " + n.column + " descending"
+}
+
+func (n *joinNode) describe() string {
+	if n.inner {
+		return "Join inner on " + n.key
+	}
+	if n.columns != nil {
+		return fmt.Sprintf("Join left on %s columns=%v", n.key, n.columns)
+	}
+	return "Join left on " + n.key
+}
+
+func (n *scanNode) inputs() []planNode    { return nil }
+func (n *filterNode) inputs() []planNode  { return []planNode{n.input} }
+func (n *projectNode) inputs() []planNode { return []planNode{n.input} }
+func (n *sortNode) inputs() []planNode    { return []planNode{n.input} }
+func (n *limitNode) inputs() []planNode   { return []planNode{n.input} }
+func (n *joinNode) inputs() []planNode    { return []planNode{n.left, n.right} }
+
+// Reads the headers of csv files and checks that every column used by the plan exists.
+// Returns the plan with the headers filled in and the columns it produces.
+func prepare(n planNode) (planNode, []string, error) {
+	switch n := n.(type) {
+	case *scanNode:
+		scan := *n
+		if scan.frame != nil {
+			scan.header = scan.frame.Columns()
+			return &scan, scan.header, nil
+		}
+
+		name := storageName(scan.path, csvFileName(scan.fileName))
+		header, exists, err := readHeader(storageOrLocal(scan.opts.Storage), name, ',', scan.opts.Encoding)
+		if err != nil {
+			return nil, nil, fmt.Errorf("lazy scan: reading the header of %s: %w", name, err)
+		}
+		if !exists {
+			return nil, nil, fmt.Errorf("lazy scan: %w", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist})
+		}
+		if len(scan.opts.Columns) > 0 {
+			if err := requireColumns("lazy scan", header, scan.opts.Columns); err != nil {
+				return nil, nil, err
+			}
+			header = scan.opts.Columns
+		}
+		scan.header = header
+		scan.limit = scan.opts.Limit
+		return &scan, header, nil
+
+	case *filterNode:
+		input, columns, err := prepare(n.input)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := requireColumns("lazy filter", columns, n.filter.columns); err != nil {
+			return nil, nil, err
+		}
+		return &filterNode{input: input, filter: n.filter}, columns, nil
+
+	case *projectNode:
+		input, columns, err := prepare(n.input)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := requireColumns("lazy select", columns, n.columns); err != nil {
+			return nil, nil, err
+		}
+		for i, col := range n.columns {
+			if slices.Contains(n.columns[:i], col) {
+				return nil, nil, fmt.Errorf("lazy select: column '%s' is selected more than once", col)
+			}
+		}
+		return &projectNode{input: input, columns: n.columns}, n.columns, nil
+
+	case *sortNode:
+		input, columns, err := prepare(n.input)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := requireColumns("lazy sort", columns, []string{n.column}); err != nil {
+			return nil, nil, err
+		}
+		return &sortNode{input: input, column: n.column, ascending: n.ascending}, columns, nil
+
+	case *limitNode:
+		input, columns, err := prepare(n.input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &limitNode{input: input, n: n.n}, columns, nil
+
+	case *joinNode:
+		left, leftColumns, err := prepare(n.left)
+		if err != nil {
+			return nil, nil, err
+		}
+		right, rightColumns, err := prepare(n.right)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !slices.Contains(leftColumns, n.key) || !slices.Contains(rightColumns, n.key) {
+			return nil, nil, fmt.Errorf("lazy join: the primary key '%s' was not found in both inputs", n.key)
+		}
+		if err := requireColumns("lazy join", rightColumns, n.columns); err != nil {
+			return nil, nil, err
+		}
+		join := &joinNode{left: left, right: right, key: n.key, inner: n.inner, columns: n.columns}
+		for _, col := range join.added(rightColumns) {
+			if slices.Contains(leftColumns, col) {
+				return nil, nil, fmt.Errorf("lazy join: column '%s' is in both inputs and is not the primary key", col)
+			}
+		}
+		return join, columnsOf(join), nil
+	}
+	return nil, nil, fmt.Errorf("lazy: unknown plan step %T", n)
+}
+
+func requireColumns(op string, available, required []string) error {
+	for _, col := range required {
+		if !slices.Contains(available, col) {
+			return fmt.Errorf("%s: column '%s' does not exist", op, col)
+		}
+	}
+	return nil
+}
+
+// Columns produced by a prepared plan.
+func columnsOf(n planNode) []string {
+	switch n := n.(type) {
+	case *scanNode:
+		if n.columns != nil {
+			return n.columns
+		}
+		return n.header
+	case *filterNode:
+		return columnsOf(n.input)
+	case *projectNode:
+		return n.columns
+	case *sortNode:
+		return columnsOf(n.input)
+	case *limitNode:
+		return columnsOf(n.input)
+	case *joinNode:
+		left := columnsOf(n.left)
+		return append(left[:len(left):len(left)], n.added(columnsOf(n.right))...)
+	}
+	return nil
+}
+
+// Columns of right that the join adds to the left rows.
+func (n *joinNode) added(rightColumns []string) []string {
+	var added []string
+	for _, col := range rightColumns {
+		if col == n.key {
+			continue
+		}
+		if n.inner || n.columns == nil || slices.Contains(n.columns, col) {
+			added = append(added, col)
+		}
+	}
+	return added
+}
+
+// Applies the optimization rules to the inputs of n and then to n itself. Reports whether anything changed.
+func rewrite(n planNode) (planNode, bool) {
+	changed := false
+	switch node := n.(type) {
+	case *filterNode:
+		input, c := rewrite(node.input)
+		changed = c
+		n = &filterNode{input: input, filter: node.filter}
+	case *projectNode:
+		input, c := rewrite(node.input)
+		changed = c
+		n = &projectNode{input: input, columns: node.columns}
+	case *sortNode:
+		input, c := rewrite(node.input)
+		changed = c
+		n = &sortNode{input: input, column: node.column, ascending: node.ascending}
+	case *limitNode:
+		input, c := rewrite(node.input)
+		changed = c
+		n = &limitNode{input: input, n: node.n}
+	case *joinNode:
+		left, cl := rewrite(node.left)
+		right, cr := rewrite(node.right)
+		changed = cl || cr
+		n = &joinNode{left: left, right: right, key: node.key, inner: node.inner, columns: node.columns}
+	}
+
+	if optimized, ok := optimizeNode(n); ok {
+		return optimized, true
+	}
+	return n, changed
+}
+
+func optimizeNode(n planNode) (planNode, bool) {
+	switch n := n.(type) {
+	case *filterNode:
+		return pushFilter(n)
+	case *projectNode:
+		return pushProjection(n)
+	case *limitNode:
+		return pushLimit(n)
+	}
+	return n, false
+}
+
+// Moves a filter below selections, into the scan, or into the join input it reads from. Filters stay
+// above sorts, since Sort picks numeric or text order from the rows it is given.
+func pushFilter(n *filterNode) (planNode, bool) {
+	switch input := n.input.(type) {
+	case *projectNode:
+		return &projectNode{input: &filterNode{input: input.input, filter: n.filter}, columns: input.columns}, true
+	case *scanNode:
+		// A limit in the scan is applied after its filters, so later filters must stay above it.
+		if input.limit > 0 {
+			return n, false
+		}
+		scan := *input
+		scan.filters = append(scan.filters[:len(scan.filters):len(scan.filters)], n.filter)
+		return &scan, true
+	case *joinNode:
+		if n.filter.columns == nil {
+			return n, false
+		}
+		join := *input
+		if containsAll(columnsOf(input.left), n.filter.columns) {
+			join.left = &filterNode{input: input.left, filter: n.filter}
+			return &join, true
+		}
+		// Rows of a left join without a match have empty right columns, so only inner joins can filter the right side first.
+		if input.inner && containsAll(columnsOf(input.right), n.filter.columns) {
+			join.right = &filterNode{input: input.right, filter: n.filter}
+			return &join, true
+		}
+	}
+	return n, false
+}
+
+// Merges adjacent selections, hands selections to the scan and removes columns joins do not need.
+func pushProjection(n *projectNode) (planNode, bool) {
+	if slices.Equal(columnsOf(n.input), n.columns) {
+		return n.input, true
+	}
+
+	switch input := n.input.(type) {
+	case *projectNode:
+		return &projectNode{input: input.input, columns: n.columns}, true
+	case *scanNode:
+		scan := *input
+		scan.columns = n.columns
+		return &scan, true
+	case *sortNode:
+		if slices.Contains(n.columns, input.column) {
+			return &sortNode{input: &projectNode{input: input.input, columns: n.columns}, column: input.column, ascending: input.ascending}, true
+		}
+	case *joinNode:
+		return pruneJoin(n, input)
+	}
+	return n, false
+}
+
+// Selects only the columns a join needs from each input: the key and the columns kept by the selection above it.
+func pruneJoin(n *projectNode, join *joinNode) (planNode, bool) {
+	needed := func(columns []string, extra ...string) []string {
+		var keep []string
+		for _, col := range columns {
+			if col == join.key || slices.Contains(n.columns, col) || slices.Contains(extra, col) {
+				keep = append(keep, col)
+			}
+		}
+		return keep
+	}
+
+	pruned := *join
+	changed := false
+	if left := columnsOf(join.left); len(needed(left)) < len(left) {
+		pruned.left = &projectNode{input: join.left, columns: needed(left)}
+		changed = true
+	}
+
+	right := columnsOf(join.right)
+	added := join.added(right)
+	if kept := needed(added); len(kept) < len(added) {
+		if !join.inner {
+			pruned.columns = append([]string{}, kept...)
+			changed = true
+		}
+		added = kept
+	}
+	if keep := needed(right, added...); len(keep) < len(right) {
+		keep = slices.DeleteFunc(keep, func(col string) bool {
+			return col != join.key && !slices.Contains(added, col)
+		})
+		pruned.right = &projectNode{input: join.right, columns: keep}
+		changed = true
+	}
+
+	if !changed {
+		return n, false
+	}
+	return &projectNode{input: &pruned, columns: n.columns}, true
+}
+
+// Moves a limit below selections and into the scan.
+func pushLimit(n *limitNode) (planNode, bool) {
+	switch input := n.input.(type) {
+	case *projectNode:
+		return &projectNode{input: &limitNode{input: input.input, n: n.n}, columns: input.columns}, true
+	case *limitNode:
+		return &limitNode{input: input.input, n: min(n.n, input.n)}, true
+	case *scanNode:
+		scan := *input
+		if scan.limit == 0 || n.n < scan.limit {
+			scan.limit = n.n
+		}
+		return &scan, true
+	}
+	return n, false
+}
+
+func containsAll(columns, required []string) bool {
+	for _, col := range required {
+		if !slices.Contains(columns, col) {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs a prepared plan. Every step returns a frame that is not shared with the input of the query.
+func execute(ctx context.Context, n planNode) (DataFrame, error) {
+	switch n := n.(type) {
+	case *scanNode:
+		return n.execute(ctx)
+
+	case *filterNode:
+		frame, err := execute(ctx, n.input)
+		if err != nil {
+			return DataFrame{}, err
+		}
+		kept := frame.FrameRecords[:0]
+		for _, row := range frame.FrameRecords {
+			if n.filter.keep(StreamingRecord{Data: row.Data, Headers: frame.Headers}) {
+				kept = append(kept, row)
+			}
+		}
+		frame.FrameRecords = kept
+		return frame, nil
+
+	case *projectNode:
+		frame, err := execute(ctx, n.input)
+		if err != nil {
+			return DataFrame{}, err
+		}
+		return project(frame.View(), n.columns), nil
+
+	case *sortNode:
+		frame, err := execute(ctx, n.input)
+		if err != nil {
+			return DataFrame{}, err
+		}
+		if err := frame.Sort(n.column, n.ascending); err != nil {
+			return DataFrame{}, err
+		}
+		return frame, nil
+
+	case *limitNode:
+		frame, err := execute(ctx, n.input)
+		if err != nil {
+			return DataFrame{}, err
+		}
+		if len(frame.FrameRecords) > n.n {
+			frame.FrameRecords = frame.FrameRecords[:n.n]
+		}
+		return frame, nil
+
+	case *joinNode:
+		left, err := execute(ctx, n.left)
+		if err != nil {
+			return DataFrame{}, err
+		}
+		right, err := execute(ctx, n.right)
+		if err != nil {
+			return DataFrame{}, err
+		}
+		if n.inner {
+			return left.InnerMerge(&right, n.key)
+		}
+		if n.columns != nil && len(n.columns) == 0 {
+			return left, nil
+		}
+		// Merge adds the columns to the rows and header map of left.
+		if err := left.Merge(&right, n.key, n.columns...); err != nil {
+			return DataFrame{}, err
+		}
+		return left, nil
+	}
+	return DataFrame{}, fmt.Errorf("lazy: unknown plan step %T", n)
+}
+
+func (n *scanNode) execute(ctx context.Context) (DataFrame, error) {
+	if n.frame != nil {
+		view := n.frame.View()
+		for _, f := range n.filters {
+			view = view.Filter(f.keep)
+		}
+		if n.limit > 0 {
+			view = view.Head(n.limit)
+		}
+		if n.columns != nil {
+			return project(view, n.columns), nil
+		}
+		return view.Materialize(), nil
+	}
+
+	opts := n.opts
+	if len(n.filters) > 0 {
+		filters := n.filters
+		if opts.Where != nil {
+			filters = append([]lazyFilter{{keep: opts.Where}}, filters...)
+		}
+		opts.Where = func(row StreamingRecord) bool {
+			for _, f := range filters {
+				if !f.keep(row) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	if n.columns != nil {
+		opts.Columns = n.columns
+	}
+	opts.Limit = n.limit
+	return createDataFrame(ctx, n.path, n.fileName, opts)
+}
+
+// Copies the given columns of the rows in a view into a new DataFrame.
+func project(view View, columns []string) DataFrame {
+	positions := make([]int, len(columns))
+	for i, col := range columns {
+		positions[i] = view.Headers[col]
+	}
+
+	df := CreateNewDataFrame(columns)
+	df.FrameRecords = make([]Record, view.Len())
+	for i := range df.FrameRecords {
+		row := view.Row(i)
+		data := make([]string, len(positions))
+		for c, pos := range positions {
+			data[c] = row.Data[pos]
+		}
+		df.FrameRecords[i] = Record{Data: data}
+	}
+	return df
+}
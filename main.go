@@ -1,6 +1,7 @@
 package dataframe
 
 import (
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"errors"
@@ -8,14 +9,12 @@ import (
 	"io"
 	"log"
 	"math"
-	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	progressbar "github.com/schollz/progressbar/v3"
 	"golang.org/x/exp/slices"
 )
 
@@ -74,28 +73,51 @@ func CreateNewDataFrame(headers []string) DataFrame {
 	return newFrame
 }
 
-// Generate a new DataFrame sourced from a csv file.
-func CreateDataFrame(path, fileName string) DataFrame {
-	if !strings.Contains(fileName, ".csv") && !strings.Contains(fileName, ".CSV") {
-		fileName = fileName + ".csv"
-	}
-
-	// Open the CSV file
-	recordFile, err := os.Open(filepath.Join(path, fileName))
-	if err != nil {
-		log.Fatalf("error opening file: please ensure the path and filename are correct: %v", err)
-	}
+// Optional settings used when loading csv files.
+type LoadOptions struct {
+	// Receives the number of bytes read. Defaults to no reporting.
+	Progress ProgressReporter
+	// Backend the files are read from. Defaults to the local filesystem.
+	Storage Storage
+	// Character encoding converted to UTF-8 while reading. Defaults to detecting it.
+	Encoding Encoding
+	// Only these columns are kept, in the given order. Defaults to every column.
+	Columns []string
+	// Number of data rows after the header that are skipped.
+	SkipRows int
+	// Maximum number of rows loaded. Reading stops once it is reached. Zero loads every row.
+	Limit int
+	// Only rows for which Where returns true are loaded. It sees every column, not only the selected ones.
+	Where func(row StreamingRecord) bool
+}
 
-	// Setup the reader
-	reader := csv.NewReader(recordFile)
+// Optional settings used when saving csv files.
+type SaveOptions struct {
+	// Receives the number of rows written. Defaults to no reporting.
+	Progress ProgressReporter
+	// Backend the file is written to. Defaults to the local filesystem.
+	Storage Storage
+	// Compresses the file and appends the matching extension when missing. Defaults to the
+	// compression implied by the file extension, e.g. gzip for data.csv.gz.
+	Compression Compression
+	// Starts the file with a UTF-8 byte order mark so Excel detects the encoding.
+	WriteBOM bool
+}
 
-	// Read the records
-	header, err := reader.Read()
-	if err != nil {
-		log.Fatalf("error reading the records: %v", err)
+// Appends the .csv extension when the file name does not include one.
+// Names of compressed files such as data.csv.gz are kept as they are.
+func csvFileName(fileName string) string {
+	if compressionFromName(fileName) != CompressionNone {
+		return fileName
 	}
+	if !strings.Contains(fileName, ".csv") && !strings.Contains(fileName, ".CSV") {
+		fileName = fileName + ".csv"
+	}
+	return fileName
+}
 
-	// Remove Byte Order Marker for UTF-8 files
+// Remove Byte Order Marker for UTF-8 files
+func removeByteOrderMark(header []string) {
 	for i, each := range header {
 		byteSlice := []byte(each)
 
@@ -107,142 +129,470 @@ func CreateDataFrame(path, fileName string) DataFrame {
 			header[i] = each[3:]
 		}
 	}
+}
+
+// Generate a new DataFrame sourced from a csv file.
+func CreateDataFrame(path, fileName string) DataFrame {
+	df, err := CreateDataFrameWithOptions(path, fileName, LoadOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return df
+}
+
+// Generate a new DataFrame sourced from a csv file. Errors are returned instead of ending the program.
+func CreateDataFrameWithOptions(path, fileName string, opts LoadOptions) (DataFrame, error) {
+	return createDataFrame(context.Background(), path, fileName, opts)
+}
+
+// Loads a csv file and stops reading once ctx is cancelled.
+func createDataFrame(ctx context.Context, path, fileName string, opts LoadOptions) (DataFrame, error) {
+	fileName = csvFileName(fileName)
+	return loadFrame(ctx, storageName(path, fileName), fileName, opts)
+}
+
+// Loads the csv file stored under name without changing the name.
+func loadFrame(ctx context.Context, name, fileName string, opts LoadOptions) (DataFrame, error) {
+	progress := progressOrSilent(opts.Progress)
+	storage := storageOrLocal(opts.Storage)
+
+	// Open the CSV file
+	recordFile, err := storage.Open(name)
+	if err != nil {
+		return DataFrame{}, fmt.Errorf("error opening file: please ensure the path and filename are correct: %w", err)
+	}
+	defer recordFile.Close()
+
+	size := int64(-1)
+	if opts.Progress != nil {
+		if info, err := storage.Stat(name); err == nil {
+			size = info.Size
+		}
+	}
+	progress.Start("loading "+fileName, size, ProgressBytes)
+
+	df, err := readFrame(contextReader{ctx: ctx, r: progressReader{r: recordFile, progress: progress}}, opts)
+	return df, finishProgress(progress, err)
+}
+
+// Stops reading once the context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// Reads csv data with a header row into a new DataFrame.
+func readFrame(r io.Reader, opts LoadOptions) (DataFrame, error) {
+	// Empty slice to store Records
+	s := []Record{}
+
+	headers, err := readCSV(r, opts, func(headers map[string]int, record []string) error {
+		s = append(s, Record{Data: record})
+		return nil
+	})
+	if err != nil {
+		return DataFrame{}, err
+	}
+
+	newFrame := DataFrame{FrameRecords: s, Headers: headers}
+	return newFrame, nil
+}
+
+// Reads csv data with a header row and passes every row to emit together with the header map,
+// which is shared by all rows. Reading stops at the first error returned by emit.
+// Gzip, zstd and bzip2 compressed data is detected and decompressed automatically.
+func readCSV(r io.Reader, opts LoadOptions, emit func(headers map[string]int, record []string) error) (map[string]int, error) {
+	data, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	text, err := decode(data, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup the reader
+	reader := csv.NewReader(text)
+
+	// Read the records
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading the records: %w", err)
+	}
+	removeByteOrderMark(header)
 
 	headers := make(map[string]int)
 	for i, columnName := range header {
 		headers[columnName] = i
 	}
 
-	// Empty slice to store Records
-	s := []Record{}
+	selector, err := newRowSelector(headers, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	// Loop over the records and create Record objects to be stored
-	for i := 0; ; i++ {
+	// Loop over the records and pass each one on
+	for !selector.done() {
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Fatalf("error in record loop: %v", err)
+			return nil, fmt.Errorf("error in record loop: %w", err)
 		}
-		// Create new Record
-		x := Record{Data: []string{}}
 
-		// Add to Data field of Record struct
-		x.Data = append(x.Data, record...)
-		s = append(s, x)
+		record, ok := selector.selectRow(record)
+		if !ok {
+			continue
+		}
+		if err := emit(selector.headers, record); err != nil {
+			return nil, err
+		}
 	}
-	newFrame := DataFrame{FrameRecords: s, Headers: headers}
-	return newFrame
+	return selector.headers, nil
+}
+
+// Applies the column selection, skipped rows, limit and filter from LoadOptions while rows are parsed.
+type rowSelector struct {
+	// Headers of the selected columns.
+	headers map[string]int
+
+	inputHeaders map[string]int
+	positions    []int
+	skip         int
+	limit        int
+	where        func(row StreamingRecord) bool
+	kept         int
+}
+
+func newRowSelector(headers map[string]int, opts LoadOptions) (*rowSelector, error) {
+	s := &rowSelector{
+		headers:      headers,
+		inputHeaders: headers,
+		skip:         opts.SkipRows,
+		limit:        opts.Limit,
+		where:        opts.Where,
+	}
+
+	if len(opts.Columns) > 0 {
+		s.headers = make(map[string]int)
+		for i, col := range opts.Columns {
+			pos, ok := headers[col]
+			if !ok {
+				return nil, fmt.Errorf("error selecting columns: column '%s' does not exist", col)
+			}
+			if _, dup := s.headers[col]; dup {
+				return nil, fmt.Errorf("error selecting columns: column '%s' is selected more than once", col)
+			}
+			s.headers[col] = i
+			s.positions = append(s.positions, pos)
+		}
+	}
+	return s, nil
+}
+
+// True once the limit is reached and no more rows need to be read.
+func (s *rowSelector) done() bool {
+	return s.limit > 0 && s.kept >= s.limit
+}
+
+// Returns the selected values of the row, or false when the row is left out.
+func (s *rowSelector) selectRow(record []string) ([]string, bool) {
+	if s.skip > 0 {
+		s.skip--
+		return nil, false
+	}
+	if s.where != nil && !s.where(StreamingRecord{Data: record, Headers: s.inputHeaders}) {
+		return nil, false
+	}
+	s.kept++
+
+	if s.positions == nil {
+		return record, true
+	}
+
+	// Copy the values so the memory of the unused columns can be released.
+	selected := make([]string, len(s.positions))
+	for i, pos := range s.positions {
+		if pos < len(record) {
+			selected[i] = strings.Clone(record[pos])
+		}
+	}
+	return selected, true
 }
 
 // Stream rows of data from a csv file to be processed. Streaming data is preferred when dealing with large files
 // and memory usage needs to be considered. Results are streamed via a channel with a StreamingRecord type.
 func Stream(path, fileName string, c chan StreamingRecord) {
+	if err := StreamWithOptions(path, fileName, c, LoadOptions{}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Same as Stream but errors are returned instead of ending the program. The channel is closed when done.
+func StreamWithOptions(path, fileName string, c chan StreamingRecord, opts LoadOptions) error {
 	defer close(c)
 
-	if !strings.Contains(fileName, ".csv") && !strings.Contains(fileName, ".CSV") {
-		fileName = fileName + ".csv"
-	}
+	fileName = csvFileName(fileName)
 
 	// Open the CSV file
-	recordFile, err := os.Open(filepath.Join(path, fileName))
+	recordFile, err := storageOrLocal(opts.Storage).Open(storageName(path, fileName))
 	if err != nil {
-		log.Fatalf("error opening the file: please ensure the path and filename are correct: %v", err)
+		return fmt.Errorf("error opening the file: please ensure the path and filename are correct: %w", err)
 	}
+	defer recordFile.Close()
 
-	// Setup the reader
-	reader := csv.NewReader(recordFile)
+	return streamCSV(recordFile, opts, c)
+}
 
-	// Read the records
-	header, err := reader.Read()
-	if err != nil {
-		log.Fatalf("error reading the records: %v", err)
+// Optional settings used when streaming csv files with StreamContext.
+type StreamOptions struct {
+	LoadOptions
+	// Capacity of the record channel. A full buffer pauses reading until the consumer catches up.
+	// Defaults to an unbuffered channel.
+	BufferSize int
+}
+
+// Stream rows of a csv file until the file ends, an error occurs or ctx is cancelled. The file is always closed.
+// The record channel is closed when streaming stops, after which the error channel delivers one value:
+// nil on success, ctx.Err() on cancellation or the error that stopped reading.
+func StreamContext(ctx context.Context, path, fileName string, opts StreamOptions) (<-chan StreamingRecord, <-chan error) {
+	bufferSize := opts.BufferSize
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+	c := make(chan StreamingRecord, bufferSize)
+	errc := make(chan error, 1)
+
+	go func() {
+		err := streamContext(ctx, path, fileName, opts.LoadOptions, c)
+		close(c)
+		errc <- err
+		close(errc)
+	}()
+	return c, errc
+}
+
+func streamContext(ctx context.Context, path, fileName string, opts LoadOptions, c chan<- StreamingRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	// Remove Byte Order Marker for UTF-8 files
-	for i, each := range header {
-		byteSlice := []byte(each)
+	fileName = csvFileName(fileName)
 
-		if len(byteSlice) < 3 {
-			continue
-		}
+	// Open the CSV file
+	recordFile, err := storageOrLocal(opts.Storage).Open(storageName(path, fileName))
+	if err != nil {
+		return fmt.Errorf("error opening the file: please ensure the path and filename are correct: %w", err)
+	}
+	defer recordFile.Close()
 
-		if byteSlice[0] == 239 && byteSlice[1] == 187 && byteSlice[2] == 191 {
-			header[i] = each[3:]
+	_, err = readCSV(recordFile, opts, func(headers map[string]int, record []string) error {
+		select {
+		case c <- StreamingRecord{Data: record, Headers: headers}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	})
+	return err
+}
+
+// Stream a csv file as DataFrames of up to chunkSize rows so files larger than memory can be processed
+// with the full DataFrame API. All chunks share one header map, so use Copy before adding or renaming
+// columns on a chunk. The channel is closed when done.
+func StreamChunks(path, fileName string, chunkSize int, c chan DataFrame, opts LoadOptions) error {
+	defer close(c)
+
+	if chunkSize <= 0 {
+		return errors.New("StreamChunks requires a chunk size of at least one row")
 	}
 
-	headers := make(map[string]int)
-	for i, columnName := range header {
-		headers[columnName] = i
+	fileName = csvFileName(fileName)
+
+	// Open the CSV file
+	recordFile, err := storageOrLocal(opts.Storage).Open(storageName(path, fileName))
+	if err != nil {
+		return fmt.Errorf("error opening the file: please ensure the path and filename are correct: %w", err)
 	}
+	defer recordFile.Close()
 
-	// Loop over the records and create Record objects to be stored
-	for i := 0; ; i++ {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			log.Fatalf("error in record loop: %v", err)
+	chunk := make([]Record, 0, chunkSize)
+	headers, err := readCSV(recordFile, opts, func(headers map[string]int, record []string) error {
+		chunk = append(chunk, Record{Data: record})
+		if len(chunk) == chunkSize {
+			c <- DataFrame{FrameRecords: chunk, Headers: headers}
+			chunk = make([]Record, 0, chunkSize)
 		}
-		// Create new Record
-		x := StreamingRecord{Headers: headers}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		// Loop over records and add to Data field of Record struct
-		x.Data = append(x.Data, record...)
-		c <- x
+	if len(chunk) > 0 {
+		c <- DataFrame{FrameRecords: chunk, Headers: headers}
 	}
+	return nil
 }
 
-func worker(jobs <-chan string, results chan<- DataFrame, resultsNames chan<- string, filePath string) {
-	for n := range jobs {
-		df := CreateDataFrame(filePath, n)
-		results <- df
-		resultsNames <- n
-	}
+// Sends every row of csv data to c as a StreamingRecord. The channel is not closed.
+func streamCSV(r io.Reader, opts LoadOptions, c chan<- StreamingRecord) error {
+	_, err := readCSV(r, opts, func(headers map[string]int, record []string) error {
+		c <- StreamingRecord{Data: record, Headers: headers}
+		return nil
+	})
+	return err
+}
+
+// Settings used by LoadFramesContext.
+type LoadFramesOptions struct {
+	LoadOptions
+	// Number of files loaded at the same time. Defaults to 4.
+	Workers int
+	// Keep loading the remaining files after a file fails and return every failure.
+	// By default loading stops at the first failure.
+	CollectErrors bool
+}
+
+// Outcome of loading a single file with LoadFramesContext.
+type FrameResult struct {
+	File  string
+	Frame DataFrame
+	// Error from loading this file only. Files that were skipped after another file failed
+	// hold the cancellation error.
+	Err error
 }
 
 // Concurrently loads multiple csv files into DataFrames within the same directory.
 // Returns a slice with the DataFrames in the same order as provided in the files parameter.
 func LoadFrames(filePath string, files []string) ([]DataFrame, error) {
-	numJobs := len(files)
+	return LoadFramesWithOptions(filePath, files, LoadOptions{})
+}
 
-	if numJobs <= 1 {
-		return nil, errors.New("LoadFrames requires at least two files")
+// Same as LoadFrames. The progress reporter in opts counts loaded files rather than bytes.
+func LoadFramesWithOptions(filePath string, files []string, opts LoadOptions) ([]DataFrame, error) {
+	results, err := LoadFramesContext(context.Background(), filePath, files, LoadFramesOptions{LoadOptions: opts})
+	if err != nil {
+		return []DataFrame{}, err
 	}
 
-	jobs := make(chan string, numJobs)
-	results := make(chan DataFrame, numJobs)
-	resultsNames := make(chan string, numJobs)
-
-	// Generate workers
-	for i := 0; i < 4; i++ {
-		go worker(jobs, results, resultsNames, filePath)
+	frames := make([]DataFrame, len(results))
+	for i, result := range results {
+		frames[i] = result.Frame
 	}
+	return frames, nil
+}
 
-	// Load up the jobs channel
-	for i := 0; i < numJobs; i++ {
-		jobs <- files[i]
+// Concurrently loads one or more csv files within the same directory. Every file gets a result in the
+// same order as files. The returned error is the first failure, or every failure joined together when
+// opts.CollectErrors is set. Loading stops when ctx is cancelled.
+func LoadFramesContext(ctx context.Context, filePath string, files []string, opts LoadFramesOptions) ([]FrameResult, error) {
+	if len(files) == 0 {
+		return nil, errors.New("LoadFrames requires at least one file")
 	}
-	close(jobs) // Close jobs channel once loaded
 
-	// Map to store results
-	jobResults := make(map[string]DataFrame)
+	return loadFiles(ctx, files, opts, func(ctx context.Context, file string, load LoadOptions) (DataFrame, error) {
+		return createDataFrame(ctx, filePath, file, load)
+	})
+}
 
-	// Collect results and store in map
-	for i := 1; i <= numJobs; i++ {
-		jobResults[<-resultsNames] = <-results
+// Loads every file with load using a pool of workers. Shared by LoadFramesContext and the directory loaders.
+func loadFiles(ctx context.Context, files []string, opts LoadFramesOptions, loadFile func(ctx context.Context, file string, load LoadOptions) (DataFrame, error)) ([]FrameResult, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 4
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	progress := progressOrSilent(opts.Progress)
+	progress.Start("loading frames", int64(len(files)), ProgressFiles)
+	load := opts.LoadOptions
+	load.Progress = nil
+
+	results := make([]FrameResult, len(files))
+	for i, f := range files {
+		results[i].File = f
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	jobs := make(chan int)
+
+	// Each job is the index of a file so results are stored next to the file they belong to.
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				df, err := loadFile(ctx, files[i], load)
+				if err != nil {
+					if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+						results[i].Err = ctx.Err()
+						continue
+					}
+					results[i].Err = fmt.Errorf("loading %s: %w", files[i], err)
+					if !opts.CollectErrors {
+						once.Do(func() {
+							firstErr = results[i].Err
+							cancel()
+						})
+					}
+					continue
+				}
+				results[i].Frame = df
+				progress.Add(1)
+			}
+		}()
 	}
 
-	var orderedResults []DataFrame
-	for _, f := range files {
-		val, ok := jobResults[f]
-		if !ok {
-			return []DataFrame{}, errors.New("error occurred while looking up returned DataFrame in the LoadFrames function")
+	for i := range files {
+		if ctx.Err() != nil {
+			results[i].Err = ctx.Err()
+			continue
 		}
-		orderedResults = append(orderedResults, val)
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var err error
+	switch {
+	case firstErr != nil:
+		err = firstErr
+	case parent.Err() != nil:
+		err = parent.Err()
+	case opts.CollectErrors:
+		var errs []error
+		for _, result := range results {
+			if result.Err != nil {
+				errs = append(errs, result.Err)
+			}
+		}
+		err = errors.Join(errs...)
 	}
-	return orderedResults, nil
+	return results, finishProgress(progress, err)
 }
 
 // Calculates number of records to include in each subframe.
@@ -295,98 +645,18 @@ func (frame DataFrame) DivideAndConquer(requestedSubFrames int) ([]DataFrame, er
 	return frames, nil
 }
 
+// Bulk insert rows into a MySQL table in batches of rowsPerBatch. Each batch is committed on its own.
+// Use BulkUpload for transactions, cancellation, upserts and other dialects.
 func (frame DataFrame) BulkUploadMySql(db *sql.DB, rowsPerBatch int, tableColumns []string, table string) error {
-	if db == nil {
-		return errors.New("bulk upload error: database nil pointer")
-	}
-	if rowsPerBatch < 1 {
-		rowsPerBatch = 1000
-	}
-	if len(tableColumns) == 0 {
-		return errors.New("bulk upload error: must provide columns")
-	}
-	if len(table) == 0 {
-		return errors.New("bulk upload error: must provide a table name")
+	opts := BulkUploadOptions{
+		Dialect:      MySQL,
+		Columns:      tableColumns,
+		RowsPerBatch: rowsPerBatch,
+		Progress:     NewTerminalProgress(nil),
 	}
 
-	frameColumns := frame.Columns()
-
-	if len(tableColumns) != len(frameColumns) {
-		return errors.New("bulk upload error: the provided columns do not match dataframe")
-	}
-
-	var cnt int
-	bulkData := [][]interface{}{}
-	bar := progressbar.Default(int64(len(frame.FrameRecords)))
-
-	for _, row := range frame.FrameRecords {
-		data := []interface{}{}
-		for _, colData := range frameColumns {
-			data = append(data, row.Val(colData, frame.Headers))
-		}
-		bulkData = append(bulkData, data)
-		bar.Add(1)
-		cnt++
-
-		if cnt == rowsPerBatch {
-			if err := insertRows(db, bulkData, table, tableColumns); err != nil {
-				return fmt.Errorf("bulk upload error: inserting records: %v", err)
-			}
-			cnt = 0
-			bulkData = nil
-		}
-	}
-
-	// Insert remaining rows that did not hit upload threshold.
-	if len(bulkData) > 0 {
-		if err := insertRows(db, bulkData, table, tableColumns); err != nil {
-			return fmt.Errorf("bulk upload error: inserting records: %v", err)
-		}
-	}
-
-	return nil
-}
-
-// Bulk insert rows into a specified table.
-func insertRows(db *sql.DB, bulkData [][]interface{}, table string, columns []string) error {
-	sqlStr := "INSERT INTO `" + table + "`("
-
-	// Add all columns to the SQL statement.
-	for _, col := range columns {
-		sqlStr += "`" + col + "`,"
-	}
-	// Trim the end to remove comma and add additional SQL.
-	sqlStr = sqlStr[0:len(sqlStr)-1] + ") VALUES "
-
-	vals := []interface{}{}
-
-	for _, data := range bulkData {
-		sqlStr += "("
-
-		// Add "?," for each of the columns.
-		for i := 0; i < len(columns); i++ {
-			sqlStr += "?,"
-		}
-		// Trim comma at the end.
-		sqlStr = sqlStr[0 : len(sqlStr)-1]
-
-		sqlStr += "),"
-		vals = append(vals, data...)
-	}
-
-	// Trim the end to remove comma.
-	sqlStr = sqlStr[0 : len(sqlStr)-1]
-
-	stmt, err := db.Prepare(sqlStr)
-	if err != nil {
-		return err
-	}
-	_, err = stmt.Exec(vals...)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-	return nil
+	_, err := frame.BulkUpload(context.Background(), db, table, opts)
+	return err
 }
 
 // User specifies columns they want to keep from a preexisting DataFrame
@@ -1102,47 +1372,66 @@ func (frame *DataFrame) StandardDeviation(fieldName string) (float64, error) {
 	return standardDeviation(nums), nil
 }
 
+// Save the DataFrame to a csv file. The .csv extension is added when missing.
 func (frame *DataFrame) SaveDataFrame(path, fileName string) bool {
-	if !strings.Contains(fileName, ".csv") && !strings.Contains(fileName, ".CSV") {
-		fileName = fileName + ".csv"
+	if err := frame.SaveDataFrameWithOptions(path, fileName, SaveOptions{}); err != nil {
+		log.Fatal(err)
+	}
+	return true
+}
+
+// Save the DataFrame to a csv file. Errors are returned instead of ending the program.
+func (frame *DataFrame) SaveDataFrameWithOptions(path, fileName string, opts SaveOptions) error {
+	fileName = csvFileName(fileName)
+	compression := opts.Compression
+	if compression == CompressionNone {
+		compression = compressionFromName(fileName)
+	} else if compressionFromName(fileName) != compression {
+		fileName += compression.extension()
 	}
+	progress := progressOrSilent(opts.Progress)
 
 	// Create the csv file
-	csvFile, err := os.Create(filepath.Join(path, fileName))
+	csvFile, err := storageOrLocal(opts.Storage).Create(storageName(path, fileName))
 	if err != nil {
-		log.Fatalf("error creating the blank csv file to save the data: %v", err)
+		return fmt.Errorf("error creating the blank csv file to save the data: %w", err)
 	}
-	defer csvFile.Close()
 
-	w := csv.NewWriter(csvFile)
-	defer w.Flush()
+	progress.Start("saving "+fileName, int64(len(frame.FrameRecords)), ProgressRows)
 
-	var data [][]string
-	var row []string
+	err = frame.writeCompressed(csvFile, FormatCSV, compression, opts.WriteBOM, progress)
+	if closeErr := closeStorageFile(csvFile, err); preferCloseError(err, closeErr) {
+		err = fmt.Errorf("error closing the csv file: %w", closeErr)
+	}
+	return finishProgress(progress, err)
+}
+
+// Writes the header and every row as csv using the provided field delimiter.
+func (frame *DataFrame) writeCSV(out io.Writer, comma rune, progress ProgressReporter) error {
+	w := csv.NewWriter(out)
+	w.Comma = comma
 	columnLength := len(frame.Headers)
 
 	// Write headers to top of file
-	for i := 0; i < columnLength; i++ {
-		for k, v := range frame.Headers {
-			if v == i {
-				row = append(row, k)
-			}
-		}
+	if err := w.Write(frame.Columns()); err != nil {
+		return fmt.Errorf("error writing the csv header: %w", err)
 	}
-	data = append(data, row)
 
 	// Add Data
+	row := make([]string, columnLength)
 	for i := 0; i < len(frame.FrameRecords); i++ {
-		var row []string
-		for pos := 0; pos < columnLength; pos++ {
-			row = append(row, frame.FrameRecords[i].Data[pos])
+		copy(row, frame.FrameRecords[i].Data[:columnLength])
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("error writing the csv records: %w", err)
 		}
-		data = append(data, row)
+		progress.Add(1)
 	}
 
-	w.WriteAll(data)
-
-	return true
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing the csv records: %w", err)
+	}
+	return nil
 }
 
 // Return the value of the specified field.
@@ -1181,9 +1470,21 @@ func (x Record) ConvertToInt(fieldName string, headers map[string]int) int64 {
 
 // Converts various date strings into time.Time
 func dateConverter(dateString string) time.Time {
+	value, err := parseDate(dateString)
+	if err != nil {
+		log.Fatalf("could not convert to time.Time: %v", err)
+	}
+	return value
+}
+
+// Parses dates in either 2006-01-02 or Excel's 1/2/06 and 1/2/2006 formats.
+func parseDate(dateString string) (time.Time, error) {
 	// Convert date if not in 2006-01-02 format
 	if strings.Contains(dateString, "/") {
 		dateSlice := strings.Split(dateString, "/")
+		if len(dateSlice) != 3 {
+			return time.Time{}, fmt.Errorf("invalid date '%s'", dateString)
+		}
 
 		if len(dateSlice[0]) != 2 {
 			dateSlice[0] = "0" + dateSlice[0]
@@ -1197,11 +1498,7 @@ func dateConverter(dateString string) time.Time {
 		dateString = dateSlice[2] + "-" + dateSlice[0] + "-" + dateSlice[1]
 	}
 
-	value, err := time.Parse("2006-01-02", dateString)
-	if err != nil {
-		log.Fatalf("could not convert to time.Time: %v", err)
-	}
-	return value
+	return time.Parse("2006-01-02", dateString)
 }
 
 // Converts date from specified field to time.Time
@@ -1,13 +1,35 @@
 package dataframe
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"log/slog"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
 )
 
 func TestStream(t *testing.T) {
@@ -1200,12 +1222,23 @@ func TestLoadFrames(t *testing.T) {
 
 func TestLoadFramesError(t *testing.T) {
 	filePath := "./"
-	files := []string{"TestData.csv"}
 
-	_, err := LoadFrames(filePath, files)
+	_, err := LoadFrames(filePath, []string{})
 	if err == nil {
 		t.Error("LoadFrames did not fail as expected")
 	}
+
+	_, err = LoadFrames(filePath, []string{"TestData.csv", "Missing.csv"})
+	if err == nil || !strings.Contains(err.Error(), "Missing.csv") {
+		t.Error("LoadFrames did not report the missing file", err)
+	}
+}
+
+func TestLoadFramesSingleFile(t *testing.T) {
+	results, err := LoadFrames("./", []string{"TestData.csv"})
+	if err != nil || len(results) != 1 || results[0].CountRecords() != 10 {
+		t.Error("LoadFrames: single file failed", err)
+	}
 }
 
 func TestRename(t *testing.T) {
@@ -1497,3 +1530,2418 @@ func TestDivideAndConquerEmptyDataFrame(t *testing.T) {
 		t.Error("Divide And Conquer: Empty dataframe error should have been triggered.")
 	}
 }
+
+func TestInsertStatementMySqlUpsert(t *testing.T) {
+	opts := BulkUploadOptions{Dialect: MySQL, Columns: []string{"id", "cost"}, Mode: Upsert, ConflictColumns: []string{"id"}}
+
+	sqlStr, err := insertStatement(opts, "db.orders", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "INSERT INTO `db`.`orders`(`id`,`cost`) VALUES (?,?),(?,?) ON DUPLICATE KEY UPDATE `cost`=VALUES(`cost`)"
+	if sqlStr != expected {
+		t.Error("Insert Statement: MySQL upsert incorrect", sqlStr)
+	}
+}
+
+func TestInsertStatementPostgres(t *testing.T) {
+	opts := BulkUploadOptions{Dialect: Postgres, Columns: []string{"id", "cost"}, Mode: Upsert, ConflictColumns: []string{"id"}}
+
+	sqlStr, err := insertStatement(opts, "orders", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `INSERT INTO "orders"("id","cost") VALUES ($1,$2),($3,$4) ON CONFLICT ("id") DO UPDATE SET "cost"=excluded."cost"`
+	if sqlStr != expected {
+		t.Error("Insert Statement: Postgres upsert incorrect", sqlStr)
+	}
+
+	opts.Mode = InsertIgnore
+	sqlStr, _ = insertStatement(opts, "orders", 1)
+	if sqlStr != `INSERT INTO "orders"("id","cost") VALUES ($1,$2) ON CONFLICT DO NOTHING` {
+		t.Error("Insert Statement: Postgres ignore incorrect", sqlStr)
+	}
+}
+
+func TestBulkUploadTransactionRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateDataFrame("./", "TestData.csv")
+	columns := []string{"id", "date", "cost", "weight", "first_name", "last_name"}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnError(errors.New("duplicate key"))
+	mock.ExpectRollback()
+
+	opts := BulkUploadOptions{Columns: columns, RowsPerBatch: 4, Transaction: true}
+	report, err := df.BulkUpload(context.Background(), db, "orders", opts)
+	if err == nil {
+		t.Error("Bulk Upload: expected an error")
+	}
+	if report.RowsInserted != 0 || report.RowsFailed != 10 || report.Batches != 2 {
+		t.Error("Bulk Upload: report incorrect", report)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBulkUploadContinueOnError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateDataFrame("./", "TestData.csv")
+	columns := []string{"id", "date", "cost", "weight", "first_name", "last_name"}
+
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnError(errors.New("bad row"))
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 2))
+
+	opts := BulkUploadOptions{Columns: columns, RowsPerBatch: 4, ContinueOnError: true}
+	report, err := df.BulkUpload(context.Background(), db, "orders", opts)
+	if err == nil {
+		t.Error("Bulk Upload: expected the failed batch to be reported")
+	}
+	if report.RowsInserted != 6 || report.RowsFailed != 4 {
+		t.Error("Bulk Upload: report incorrect", report)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBulkUploadCancelled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateDataFrame("./", "TestData.csv")
+	columns := []string{"id", "date", "cost", "weight", "first_name", "last_name"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := df.BulkUpload(ctx, db, "orders", BulkUploadOptions{Columns: columns})
+	if !errors.Is(err, context.Canceled) {
+		t.Error("Bulk Upload: expected context cancellation", err)
+	}
+	if report.RowsFailed != 10 {
+		t.Error("Bulk Upload: report incorrect", report)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInferSchema(t *testing.T) {
+	df := CreateNewDataFrame([]string{"ID", "Date", "Price", "Zip", "Name"})
+	df = df.AddRecord([]string{"1", "2022-01-01", "10.5", "01234", "Kevin"})
+	df = df.AddRecord([]string{"2", "1/2/2022", "-123.25", "45678", ""})
+	df = df.AddRecord([]string{"3000000000", "", "7", "90210", "Avery Lynn"})
+
+	schema := df.InferSchema()
+
+	if schema[0].Type != IntegerType || schema[0].SQLType(MySQL) != "BIGINT" {
+		t.Error("Infer Schema: ID should be a big integer", schema[0])
+	}
+	if schema[1].Type != DateType || !schema[1].Nullable {
+		t.Error("Infer Schema: Date should be a nullable date", schema[1])
+	}
+	if schema[2].Type != DecimalType || schema[2].Precision != 5 || schema[2].Scale != 2 {
+		t.Error("Infer Schema: Price should be DECIMAL(5,2)", schema[2])
+	}
+	if schema[3].Type != VarcharType || schema[3].Length != 5 {
+		t.Error("Infer Schema: Zip with leading zeros should be text", schema[3])
+	}
+	if schema[4].SQLType(Postgres) != "VARCHAR(10)" || !schema[4].Nullable {
+		t.Error("Infer Schema: Name should be a nullable VARCHAR(10)", schema[4])
+	}
+}
+
+func TestCreateTableSQL(t *testing.T) {
+	df := CreateDataFrame("./", "TestData.csv")
+
+	expected := "CREATE TABLE `orders` (\n" +
+		"  `ID` INT NOT NULL,\n" +
+		"  `Date` DATE NOT NULL,\n" +
+		"  `Cost` INT NOT NULL,\n" +
+		"  `Weight` INT NOT NULL,\n" +
+		"  `First Name` VARCHAR(5) NOT NULL,\n" +
+		"  `Last Name` VARCHAR(8) NOT NULL\n" +
+		")"
+
+	if sqlStr := df.CreateTableSQL(MySQL, "orders"); sqlStr != expected {
+		t.Error("Create Table SQL: statement incorrect", sqlStr)
+	}
+}
+
+func TestCheckTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateDataFrame("./", "TestData.csv")
+	columns := []string{"id", "date", "cost", "weight", "first_name", "last_name"}
+
+	rows := sqlmock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("id").OfType("INT", int64(0)),
+		sqlmock.NewColumn("date").OfType("VARCHAR", "").WithLength(10),
+		sqlmock.NewColumn("cost").OfType("INT", int64(0)),
+		sqlmock.NewColumn("weight").OfType("DATE", ""),
+		sqlmock.NewColumn("first_name").OfType("VARCHAR", "").WithLength(3),
+	)
+	mock.ExpectQuery("SELECT \\* FROM `orders` WHERE 1=0").WillReturnRows(rows)
+
+	err = df.CheckTable(context.Background(), db, MySQL, "orders", columns)
+	if err == nil {
+		t.Fatal("Check Table: expected an error")
+	}
+	for _, problem := range []string{"'weight' is DATE", "'first_name' allows 3", "'last_name' does not exist"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Error("Check Table: missing problem", problem, err)
+		}
+	}
+}
+
+func TestBulkUploadCreateTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateDataFrame("./", "TestData.csv")
+	columns := []string{"id", "date", "cost", "weight", "first_name", "last_name"}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `orders`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 10))
+
+	report, err := df.BulkUpload(context.Background(), db, "orders", BulkUploadOptions{Columns: columns, CreateTable: true})
+	if err != nil || report.RowsInserted != 10 {
+		t.Error("Bulk Upload: create table failed", report, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBulkUploadCreateTableMapping(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateNewDataFrame([]string{"ID"})
+	df = df.AddRecord([]string{"1"}).AddRecord([]string{"x"}).AddRecord([]string{"3"})
+
+	// Computed values run once per row, so the inferred schema matches the inserted values.
+	var seq int64
+	opts := BulkUploadOptions{
+		Mapping: []ColumnMapping{
+			{Column: "seq", Compute: func(Record, map[string]int) (interface{}, error) { seq++; return seq, nil }},
+			{Column: "id", Source: "ID", Convert: ToInt},
+		},
+		CreateTable:     true,
+		ContinueOnError: true,
+	}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `orders`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().
+		WithArgs(int64(1), int64(1), int64(3), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	report, err := df.BulkUpload(context.Background(), db, "orders", opts)
+	if err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Error("Bulk Upload Create Table: conversion error not reported", err)
+	}
+	if report.RowsInserted != 2 || report.RowsFailed != 1 || seq != 3 {
+		t.Error("Bulk Upload Create Table: report incorrect", report, seq)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBulkUploadMapping(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateNewDataFrame([]string{"ID", "Cost", "Note"})
+	df = df.AddRecord([]string{"1", "10.5", "first"})
+	df = df.AddRecord([]string{"2", "", ""})
+
+	loaded := time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC)
+	opts := BulkUploadOptions{
+		Mapping: []ColumnMapping{
+			{Column: "order_id", Source: "ID", Convert: ToInt},
+			{Column: "cost", Source: "Cost", Convert: NullIfEmpty(ToFloat)},
+			{Column: "loaded_at", Compute: Constant(loaded)},
+		},
+	}
+
+	mock.ExpectPrepare("INSERT INTO `orders`\\(`order_id`,`cost`,`loaded_at`\\) VALUES \\(\\?,\\?,\\?\\),\\(\\?,\\?,\\?\\)$").
+		ExpectExec().
+		WithArgs(int64(1), 10.5, loaded, int64(2), nil, loaded).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	report, err := df.BulkUpload(context.Background(), db, "orders", opts)
+	if err != nil || report.RowsInserted != 2 {
+		t.Error("Bulk Upload Mapping: upload failed", report, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBulkUploadMappingErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateDataFrame("./", "TestData.csv")
+
+	opts := BulkUploadOptions{Mapping: []ColumnMapping{{Column: "name", Source: "Name"}}}
+	if _, err := df.BulkUpload(context.Background(), db, "orders", opts); err == nil {
+		t.Error("Bulk Upload Mapping: missing source column should fail")
+	}
+
+	opts = BulkUploadOptions{Mapping: []ColumnMapping{{Column: "date", Source: "Date", Convert: ToInt}}}
+	report, err := df.BulkUpload(context.Background(), db, "orders", opts)
+	if err == nil || report.RowsFailed != 10 {
+		t.Error("Bulk Upload Mapping: conversion error should fail the upload", report, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMappedSchema(t *testing.T) {
+	df := CreateDataFrame("./", "TestData.csv")
+	mapping := []ColumnMapping{
+		{Column: "date", Source: "Date", Convert: ToDate},
+		{Column: "loaded_at", Compute: Constant(time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC))},
+	}
+
+	rows, errs := df.mappedRows(mapping)
+	if err := errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+	schema := mappedSchema(mapping, rows)
+	if schema[0].Type != DateType || schema[1].SQLType(MySQL) != "DATETIME" {
+		t.Error("Mapped Schema: types incorrect", schema)
+	}
+}
+
+func TestCreateDataFrameWithOptionsProgress(t *testing.T) {
+	var total, done int64
+	var finished bool
+	progress := CallbackProgress{
+		OnStart:  func(operation string, n int64, unit ProgressUnit) { total = n },
+		OnAdd:    func(n int64) { done += n },
+		OnFinish: func() { finished = true },
+	}
+
+	df, err := CreateDataFrameWithOptions("./", "TestData.csv", LoadOptions{Progress: progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if df.CountRecords() != 10 {
+		t.Error("Progress: frame not loaded correctly")
+	}
+	if total != 393 || done != total || !finished {
+		t.Error("Progress: byte counts incorrect", total, done, finished)
+	}
+}
+
+func TestCreateDataFrameWithOptionsMissingFile(t *testing.T) {
+	_, err := CreateDataFrameWithOptions("./", "DoesNotExist.csv", LoadOptions{})
+	if err == nil {
+		t.Error("Create DataFrame: expected an error for a missing file")
+	}
+}
+
+func TestSaveDataFrameWithOptionsProgress(t *testing.T) {
+	df := CreateDataFrame("./", "TestData.csv")
+	path := t.TempDir()
+
+	var rows int64
+	progress := CallbackProgress{OnAdd: func(n int64) { rows += n }}
+
+	if err := df.SaveDataFrameWithOptions(path, "Saved", SaveOptions{Progress: progress}); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 10 {
+		t.Error("Progress: row count incorrect", rows)
+	}
+
+	saved := CreateDataFrame(path, "Saved.csv")
+	if saved.CountRecords() != 10 || saved.Sum("Cost") != 6521.0 {
+		t.Error("Save DataFrame: saved frame incorrect")
+	}
+}
+
+func TestSlogProgress(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	df := CreateDataFrame("./", "TestData.csv")
+	columns := []string{"id", "date", "cost", "weight", "first_name", "last_name"}
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnError(errors.New("connection lost"))
+
+	opts := BulkUploadOptions{Columns: columns, Progress: NewSlogProgress(logger, 0)}
+	if _, err := df.BulkUpload(context.Background(), db, "orders", opts); err == nil {
+		t.Fatal("Bulk Upload: expected an error")
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, `"msg":"progress started","operation":"uploading to orders","total":10,"unit":"rows"`) {
+		t.Error("Slog Progress: start not logged", output)
+	}
+	if !strings.Contains(output, `"msg":"progress failed"`) || !strings.Contains(output, "connection lost") {
+		t.Error("Slog Progress: failure not logged", output)
+	}
+}
+
+// Minimal S3 compatible server used to test the S3 functions without AWS.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+	// Uploads are refused with AccessDenied when set.
+	denyWrites bool
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, S3Config) {
+	fake := &fakeS3{objects: make(map[string][]byte), headers: make(map[string]http.Header)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg := S3Config{
+		Region:          "us-east-1",
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		Endpoint:        server.URL,
+		ForcePathStyle:  true,
+		DisableSSL:      true,
+	}
+	return fake, cfg
+}
+
+func (f *fakeS3) put(bucket, key string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[bucket+"/"+key] = data
+}
+
+func (f *fakeS3) get(bucket, key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[bucket+"/"+key]
+	return data, ok
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+
+	if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+		f.list(w, name, r.URL.Query())
+		return
+	}
+
+	f.mu.Lock()
+	deny := f.denyWrites
+	f.mu.Unlock()
+	if deny && (r.Method == http.MethodPut || r.Method == http.MethodPost) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.mu.Lock()
+		f.objects[name] = data
+		f.headers[name] = r.Header.Clone()
+		f.mu.Unlock()
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead, http.MethodGet:
+		f.mu.Lock()
+		data, ok := f.objects[name]
+		f.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if rng := r.Header.Get("Range"); len(rng) > 0 {
+			var start, end int
+			fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			if end >= len(data) {
+				end = len(data) - 1
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+			w.WriteHeader(http.StatusPartialContent)
+			if r.Method == http.MethodGet {
+				w.Write(data[start : end+1])
+			}
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// Lists objects two at a time so pagination is exercised.
+func (f *fakeS3) list(w http.ResponseWriter, bucket string, query url.Values) {
+	prefix := query.Get("prefix")
+	start, _ := strconv.Atoi(query.Get("continuation-token"))
+
+	f.mu.Lock()
+	var keys []string
+	for name := range f.objects {
+		key := strings.TrimPrefix(name, bucket+"/")
+		if key != name && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	f.mu.Unlock()
+	sort.Strings(keys)
+
+	end := start + 2
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>`)
+	sb.WriteString("<Name>" + bucket + "</Name><Prefix>" + prefix + "</Prefix>")
+	sb.WriteString("<KeyCount>" + strconv.Itoa(end-start) + "</KeyCount>")
+	if end < len(keys) {
+		sb.WriteString("<IsTruncated>true</IsTruncated><NextContinuationToken>" + strconv.Itoa(end) + "</NextContinuationToken>")
+	} else {
+		sb.WriteString("<IsTruncated>false</IsTruncated>")
+	}
+	for _, key := range keys[start:end] {
+		sb.WriteString("<Contents><Key>" + key + "</Key></Contents>")
+	}
+	sb.WriteString("</ListBucketResult>")
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(sb.String()))
+}
+
+func TestS3ConfigCredentials(t *testing.T) {
+	before := os.Getenv("AWS_ACCESS_KEY")
+
+	cfg := S3Config{Region: "us-west-1", AccessKeyID: "key", SecretAccessKey: "secret", SessionToken: "token"}
+	sess, err := cfg.session()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := sess.Config.Credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "key" || creds.SecretAccessKey != "secret" || creds.SessionToken != "token" {
+		t.Error("S3 Config: static credentials not used", creds)
+	}
+	if os.Getenv("AWS_ACCESS_KEY") != before {
+		t.Error("S3 Config: environment was modified")
+	}
+
+	if _, err := (S3Config{SessionToken: "token"}).session(); err == nil {
+		t.Error("S3 Config: session token without keys should fail")
+	}
+}
+
+func TestS3UploadAndDownload(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+
+	if err := UploadFileToS3(cfg, "./", "TestData.csv", "bucket", S3TransferOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.get("bucket", "TestData.csv"); !ok {
+		t.Fatal("S3: upload did not reach the server")
+	}
+
+	var downloaded int64
+	opts := S3TransferOptions{
+		Path:     t.TempDir(),
+		Progress: CallbackProgress{OnAdd: func(n int64) { atomic.AddInt64(&downloaded, n) }},
+	}
+	df, err := CreateDataFrameFromS3(cfg, "bucket", "TestData.csv", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if df.CountRecords() != 10 || df.Sum("Cost") != 6521.0 {
+		t.Error("S3: downloaded frame incorrect")
+	}
+	if downloaded != 393 {
+		t.Error("S3: download progress incorrect", downloaded)
+	}
+}
+
+func TestSaveDataFrameToS3(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+	df := CreateDataFrame("./", "TestData.csv")
+
+	opts := S3SaveOptions{
+		Config:               cfg,
+		Gzip:                 true,
+		Metadata:             map[string]string{"Source": "unit-test"},
+		Tags:                 map[string]string{"team": "analytics"},
+		ServerSideEncryption: "AES256",
+	}
+	if err := df.SaveDataFrameToS3("bucket", "exports/data.tsv.gz", FormatTSV, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := fake.get("bucket", "exports/data.tsv.gz")
+	if !ok {
+		t.Fatal("Save DataFrame To S3: object not uploaded")
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := csv.NewReader(gz)
+	reader.Comma = '\t'
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 11 || records[0][4] != "First Name" || records[10][4] != "Carl" {
+		t.Error("Save DataFrame To S3: object content incorrect", records)
+	}
+
+	fake.mu.Lock()
+	header := fake.headers["bucket/exports/data.tsv.gz"]
+	fake.mu.Unlock()
+	if header.Get("Content-Encoding") != "gzip" || header.Get("Content-Type") != "text/tab-separated-values" {
+		t.Error("Save DataFrame To S3: content headers incorrect", header)
+	}
+	if header.Get("X-Amz-Meta-Source") != "unit-test" || header.Get("X-Amz-Tagging") != "team=analytics" {
+		t.Error("Save DataFrame To S3: metadata or tags missing", header)
+	}
+	if header.Get("X-Amz-Server-Side-Encryption") != "AES256" {
+		t.Error("Save DataFrame To S3: encryption header missing", header)
+	}
+}
+
+func TestSaveDataFrameToS3Error(t *testing.T) {
+	_, cfg := newFakeS3(t)
+	cfg.Endpoint = "http://127.0.0.1:1"
+	df := CreateDataFrame("./", "TestData.csv")
+
+	err := df.SaveDataFrameToS3("bucket", "data.csv", FormatCSV, S3SaveOptions{Config: cfg})
+	if err == nil || !strings.Contains(err.Error(), "save dataframe to s3") {
+		t.Error("Save DataFrame To S3: expected a wrapped error", err)
+	}
+}
+
+func TestSaveDataFrameToS3Denied(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+	fake.denyWrites = true
+
+	// Larger than one upload part, so the writer is still running when the upload is refused.
+	df := CreateNewDataFrame([]string{"ID", "Text"})
+	text := strings.Repeat("x", 100)
+	for i := 0; i < 60000; i++ {
+		df = df.AddRecord([]string{strconv.Itoa(i), text})
+	}
+
+	storage, err := NewS3Storage(cfg, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range []DataFrame{CreateDataFrame("./", "TestData.csv"), df} {
+		err := frame.SaveDataFrameToS3("bucket", "data.csv", FormatCSV, S3SaveOptions{Config: cfg})
+		if err == nil || !strings.Contains(err.Error(), "AccessDenied") || strings.Contains(err.Error(), "upload finished") {
+			t.Error("Save DataFrame To S3: upload error not reported", frame.CountRecords(), err)
+		}
+		err = frame.SaveDataFrameWithOptions("exports", "data", SaveOptions{Storage: storage})
+		if err == nil || !strings.Contains(err.Error(), "AccessDenied") || strings.Contains(err.Error(), "upload finished") {
+			t.Error("S3 Storage: upload error not reported", frame.CountRecords(), err)
+		}
+	}
+}
+
+func TestLoadFramesFromS3(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+
+	for _, name := range []string{"TestData.csv", "TestDataConcat.csv", "TestDataDateFormat.csv"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fake.put("bucket", "daily/"+name, data)
+	}
+	fake.put("bucket", "daily/readme.txt", []byte("not a csv"))
+	fake.put("bucket", "other/TestData.csv", []byte("ID\n1\n"))
+
+	opts := S3ListOptions{Config: cfg, Prefix: "daily/", Pattern: "daily/*.csv", Workers: 2}
+	frames, keys, err := LoadFramesFromS3("bucket", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"daily/TestData.csv", "daily/TestDataConcat.csv", "daily/TestDataDateFormat.csv"}
+	if len(keys) != len(expected) {
+		t.Fatal("Load Frames From S3: keys incorrect", keys)
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Error("Load Frames From S3: keys out of order", keys)
+		}
+	}
+	if frames[0].Sum("Weight") != 3376.0 || frames[1].Sum("Weight") != 445.0 || frames[2].Average("Cost") != 652.1 {
+		t.Error("Load Frames From S3: frames not paired with their keys")
+	}
+}
+
+func TestConcatFramesFromS3(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+
+	for _, name := range []string{"TestData.csv", "TestDataConcat.csv"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fake.put("bucket", "daily/"+name, data)
+	}
+
+	df, err := ConcatFramesFromS3("bucket", S3ListOptions{Config: cfg, Prefix: "daily/", SourceColumn: "Source Key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if df.CountRecords() != 20 || len(df.Columns()) != 7 {
+		t.Fatal("Concat Frames From S3: frame incorrect", df.CountRecords(), df.Columns())
+	}
+	if df.FrameRecords[0].Val("Source Key", df.Headers) != "daily/TestData.csv" ||
+		df.FrameRecords[19].Val("Source Key", df.Headers) != "daily/TestDataConcat.csv" {
+		t.Error("Concat Frames From S3: source key column incorrect")
+	}
+}
+
+func TestCreateDataFrameFromS3WithoutLocalFile(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+
+	data, err := os.ReadFile("TestData.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.put("bucket", "reports/TestData.csv", data)
+
+	// The working directory must stay untouched.
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	for _, mode := range []S3DownloadMode{DownloadToMemory, DownloadStreaming} {
+		var downloaded int64
+		opts := S3TransferOptions{
+			Mode:     mode,
+			Progress: CallbackProgress{OnAdd: func(n int64) { atomic.AddInt64(&downloaded, n) }},
+		}
+
+		df, err := CreateDataFrameFromS3(cfg, "bucket", "reports/TestData.csv", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if df.CountRecords() != 10 || df.Sum("Cost") != 6521.0 {
+			t.Error("S3 Download Mode: frame incorrect", mode)
+		}
+		if downloaded != 393 {
+			t.Error("S3 Download Mode: progress incorrect", mode, downloaded)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Error("S3 Download Mode: files were written to disk", entries)
+	}
+}
+
+func TestStreamFromS3(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+	firstNameAnswers := []string{"Kevin", "Beth", "Avery", "Peter", "Andy", "Nick", "Bryan", "Brian", "Eric", "Carl"}
+
+	data, err := os.ReadFile("TestData.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.put("bucket", "TestData.csv", data)
+
+	c := make(chan StreamingRecord)
+	errc := make(chan error, 1)
+	go func() { errc <- StreamFromS3(cfg, "bucket", "TestData.csv", c) }()
+
+	i := 0
+	for row := range c {
+		if row.Val("First Name") != firstNameAnswers[i] {
+			t.Error("Stream From S3: first name did not match.")
+		}
+		i++
+	}
+	if err := <-errc; err != nil || i != 10 {
+		t.Error("Stream From S3: stream incomplete", i, err)
+	}
+
+	c = make(chan StreamingRecord)
+	if err := StreamFromS3(cfg, "bucket", "Missing.csv", c); err == nil {
+		t.Error("Stream From S3: missing object should fail")
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	df := CreateDataFrame(".", "TestData.csv")
+
+	if err := df.SaveDataFrameWithOptions("out", "Copy", SaveOptions{Storage: storage}); err != nil {
+		t.Fatal("Memory Storage: save failed", err)
+	}
+	if info, err := storage.Stat("out/Copy.csv"); err != nil || info.Size == 0 {
+		t.Error("Memory Storage: stat failed", info, err)
+	}
+
+	loaded, err := CreateDataFrameWithOptions("out", "Copy.csv", LoadOptions{Storage: storage})
+	if err != nil {
+		t.Fatal("Memory Storage: load failed", err)
+	}
+	if loaded.CountRecords() != 10 || loaded.Sum("Cost") != 6521 {
+		t.Error("Memory Storage: loaded frame incorrect", loaded.CountRecords(), loaded.Sum("Cost"))
+	}
+
+	if err := df.SaveDataFrameWithOptions("out", "Second", SaveOptions{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	names, err := storage.List("out/")
+	if err != nil || len(names) != 2 || names[0] != "out/Copy.csv" || names[1] != "out/Second.csv" {
+		t.Error("Memory Storage: list incorrect", names, err)
+	}
+
+	frames, err := LoadFramesWithOptions("out", []string{"Copy", "Second"}, LoadOptions{Storage: storage})
+	if err != nil || len(frames) != 2 || frames[1].CountRecords() != 10 {
+		t.Error("Memory Storage: load frames failed", err)
+	}
+
+	c := make(chan StreamingRecord)
+	errc := make(chan error, 1)
+	go func() { errc <- StreamWithOptions("out", "Copy", c, LoadOptions{Storage: storage}) }()
+	total := 0.0
+	for row := range c {
+		total += row.ConvertToFloat("Cost")
+	}
+	if err := <-errc; err != nil || total != 6521 {
+		t.Error("Memory Storage: stream incorrect", total, err)
+	}
+
+	if _, err := CreateDataFrameWithOptions("out", "Missing", LoadOptions{Storage: storage}); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Memory Storage: missing file error incorrect", err)
+	}
+}
+
+func TestFailedSaveKeepsFile(t *testing.T) {
+	df := CreateDataFrame(".", "TestData.csv")
+	// Writing bzip2 is not supported, so the save fails before any data is written.
+	failing := SaveOptions{Compression: CompressionBzip2}
+
+	// The zero value of MemoryStorage is usable.
+	var memory MemoryStorage
+	old, err := memory.Create("out/Copy.csv.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Write([]byte("old"))
+	if err := old.Close(); err != nil {
+		t.Fatal("Failed Save: zero value memory storage failed", err)
+	}
+	failing.Storage = &memory
+	if err := df.SaveDataFrameWithOptions("out", "Copy", failing); err == nil {
+		t.Fatal("Failed Save: expected an error")
+	}
+	file, err := memory.Open("out/Copy.csv.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(file); string(data) != "old" {
+		t.Error("Failed Save: memory file replaced", string(data))
+	}
+
+	fake, cfg := newFakeS3(t)
+	s3Storage, err := NewS3Storage(cfg, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.put("bucket", "out/Copy.csv.bz2", []byte("old"))
+	failing.Storage = s3Storage
+	if err := df.SaveDataFrameWithOptions("out", "Copy", failing); err == nil {
+		t.Fatal("Failed Save: expected an error")
+	}
+	if data, _ := fake.get("bucket", "out/Copy.csv.bz2"); string(data) != "old" {
+		t.Error("Failed Save: s3 object replaced", string(data))
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewLocalStorage(dir)
+	df := CreateDataFrame(".", "TestData.csv")
+
+	if err := df.SaveDataFrameWithOptions("nested/dir", "Copy", SaveOptions{Storage: storage}); err != nil {
+		t.Fatal("Local Storage: save failed", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nested", "dir", "Copy.csv")); err != nil {
+		t.Error("Local Storage: file not written under root", err)
+	}
+
+	names, err := storage.List("nested/d")
+	if err != nil || len(names) != 1 || names[0] != "nested/dir/Copy.csv" {
+		t.Error("Local Storage: list incorrect", names, err)
+	}
+	if names, _ := storage.List("other/"); len(names) != 0 {
+		t.Error("Local Storage: missing directory should list nothing", names)
+	}
+
+	loaded, err := CreateDataFrameWithOptions("nested/dir", "Copy", LoadOptions{Storage: storage})
+	if err != nil || loaded.Sum("Weight") != 3376 {
+		t.Error("Local Storage: load failed", err)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+	storage, err := NewS3Storage(cfg, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	df := CreateDataFrame(".", "TestData.csv")
+
+	if err := df.SaveDataFrameWithOptions("exports", "Copy", SaveOptions{Storage: storage}); err != nil {
+		t.Fatal("S3 Storage: save failed", err)
+	}
+	data, ok := fake.get("bucket", "exports/Copy.csv")
+	if !ok {
+		t.Fatal("S3 Storage: object not uploaded")
+	}
+
+	var total int64
+	progress := CallbackProgress{OnStart: func(_ string, n int64, _ ProgressUnit) { total = n }}
+	loaded, err := CreateDataFrameWithOptions("exports", "Copy", LoadOptions{Storage: storage, Progress: progress})
+	if err != nil || loaded.CountRecords() != 10 {
+		t.Error("S3 Storage: load failed", err)
+	}
+	if total != int64(len(data)) {
+		t.Error("S3 Storage: size from stat incorrect", total)
+	}
+
+	names, err := storage.List("exports/")
+	if err != nil || len(names) != 1 || names[0] != "exports/Copy.csv" {
+		t.Error("S3 Storage: list incorrect", names, err)
+	}
+	if _, err := storage.Stat("exports/Missing.csv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("S3 Storage: missing object error incorrect", err)
+	}
+	if _, err := NewS3Storage(cfg, ""); err == nil {
+		t.Error("S3 Storage: empty bucket should fail")
+	}
+}
+
+func TestCompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	df := CreateDataFrame(".", "TestData.csv")
+
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		if err := df.SaveDataFrameWithOptions(dir, "Compressed", SaveOptions{Compression: c}); err != nil {
+			t.Fatal("Compressed Files: save failed", c, err)
+		}
+
+		fileName := "Compressed.csv" + c.extension()
+		loaded, err := CreateDataFrameWithOptions(dir, fileName, LoadOptions{})
+		if err != nil {
+			t.Fatal("Compressed Files: load failed", c, err)
+		}
+		if loaded.CountRecords() != 10 || loaded.Sum("Cost") != 6521 {
+			t.Error("Compressed Files: loaded frame incorrect", c, loaded.CountRecords())
+		}
+
+		raw, _ := os.ReadFile(filepath.Join(dir, fileName))
+		if bytes.HasPrefix(raw, []byte("First Name")) {
+			t.Error("Compressed Files: file was not compressed", c)
+		}
+	}
+
+	// Bzip2 can only be read.
+	loaded, err := CreateDataFrameWithOptions(".", "TestData.csv.bz2", LoadOptions{})
+	if err != nil || loaded.Sum("Weight") != 3376 {
+		t.Error("Compressed Files: bzip2 load failed", err)
+	}
+	if err := df.SaveDataFrameWithOptions(dir, "Bz", SaveOptions{Compression: CompressionBzip2}); err == nil {
+		t.Error("Compressed Files: saving bzip2 should fail")
+	}
+
+	// Text that starts like the bzip2 magic is not bzip2.
+	if err := os.WriteFile(filepath.Join(dir, "BZh.csv"), []byte("BZhCode,Name\n1,x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := CreateDataFrameWithOptions(dir, "BZh.csv", LoadOptions{}); err != nil || loaded.CountRecords() != 1 || loaded.Columns()[0] != "BZhCode" {
+		t.Error("Compressed Files: plain text detected as bzip2", err)
+	}
+
+	// Compression comes from the extension when not set and is detected from the content when loading.
+	if err := df.SaveDataFrameWithOptions(dir, "Named.csv.gz", SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "Named.csv.gz"))
+	if !bytes.HasPrefix(raw, gzipMagic) {
+		t.Error("Compressed Files: extension did not select gzip")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Renamed.gz"), raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateDataFrameWithOptions(dir, "Renamed.gz", LoadOptions{}); err != nil {
+		t.Error("Compressed Files: .gz without .csv should not get an extension appended", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Hidden.csv"), raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := CreateDataFrameWithOptions(dir, "Hidden", LoadOptions{}); err != nil || loaded.CountRecords() != 10 {
+		t.Error("Compressed Files: magic bytes not detected", err)
+	}
+
+	c := make(chan StreamingRecord)
+	errc := make(chan error, 1)
+	go func() { errc <- StreamWithOptions(dir, "Compressed.csv.zst", c, LoadOptions{}) }()
+	rows := 0
+	for range c {
+		rows++
+	}
+	if err := <-errc; err != nil || rows != 10 {
+		t.Error("Compressed Files: stream failed", rows, err)
+	}
+}
+
+func TestEncodingDetection(t *testing.T) {
+	dir := t.TempDir()
+	text := "Name,City\r\nJosé,Zürich\r\nRenée,Málaga\r\n"
+
+	utf16le, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16be, err := unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewEncoder().String(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	windows1252, err := charmap.Windows1252.NewEncoder().String(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"utf8bom.csv": "\xef\xbb\xbf" + text,
+		"utf16le.csv": utf16le,
+		"utf16be.csv": utf16be,
+		"cp1252.csv":  windows1252,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		df, err := CreateDataFrameWithOptions(dir, name, LoadOptions{})
+		if err != nil {
+			t.Fatal("Encoding Detection: load failed", name, err)
+		}
+		if _, ok := df.Headers["Name"]; !ok {
+			t.Error("Encoding Detection: header incorrect", name, df.Columns())
+		}
+		if df.CountRecords() != 2 || df.FrameRecords[0].Val("Name", df.Headers) != "José" || df.FrameRecords[1].Val("City", df.Headers) != "Málaga" {
+			t.Error("Encoding Detection: values garbled", name, df.FrameRecords)
+		}
+	}
+
+	// Accents after the sniffed start of the file are decoded correctly in either encoding.
+	padding := "Name,City\r\n" + strings.Repeat("Smith,Boston\r\n", 500)
+	late1252, _ := charmap.Windows1252.NewEncoder().String("José,Zürich\r\n")
+	for name, data := range map[string]string{"late1252.csv": padding + late1252, "lateutf8.csv": padding + "José,Zürich\r\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		df, err := CreateDataFrameWithOptions(dir, name, LoadOptions{})
+		if err != nil || df.CountRecords() != 501 || df.FrameRecords[500].Val("Name", df.Headers) != "José" || df.FrameRecords[500].Val("City", df.Headers) != "Zürich" {
+			t.Error("Encoding Detection: late accents garbled", name, err)
+		}
+	}
+
+	// Explicit encodings override detection.
+	latin1, _ := charmap.ISO8859_1.NewEncoder().String(text)
+	if err := os.WriteFile(filepath.Join(dir, "latin1.csv"), []byte(latin1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	df, err := CreateDataFrameWithOptions(dir, "latin1.csv", LoadOptions{Encoding: EncodingISO88591})
+	if err != nil || df.FrameRecords[0].Val("City", df.Headers) != "Zürich" {
+		t.Error("Encoding Detection: explicit encoding failed", err)
+	}
+}
+
+func TestSaveWithBOM(t *testing.T) {
+	dir := t.TempDir()
+	df := CreateDataFrame(".", "TestData.csv")
+
+	if err := df.SaveDataFrameWithOptions(dir, "Excel", SaveOptions{WriteBOM: true}); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "Excel.csv"))
+	if err != nil || !bytes.HasPrefix(raw, []byte{0xef, 0xbb, 0xbf}) {
+		t.Error("Save With BOM: byte order mark missing", err)
+	}
+
+	loaded := CreateDataFrame(dir, "Excel")
+	if _, ok := loaded.Headers["First Name"]; !ok {
+		t.Error("Save With BOM: byte order mark not removed on load", loaded.Columns())
+	}
+}
+
+func TestFixedWidth(t *testing.T) {
+	dir := t.TempDir()
+	spec := FixedWidthSpec{
+		Columns: []FixedWidthColumn{
+			{Name: "Id", Start: 1, Width: 5, Align: AlignRight, Pad: '0', Trim: TrimLeading, Cutset: "0"},
+			{Name: "Name", Start: 6, Width: 10},
+			{Name: "Amount", Start: 17, Width: 8, Align: AlignRight},
+		},
+		SkipLines: 1,
+	}
+
+	data := "EXTRACT 2024-01-31\r\n" +
+		"00012Kevin       1500.25\r\n" +
+		"00345Beth          12.00\r\n" +
+		"00007Avery\r\n" +
+		"\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "extract.txt"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	df, short, err := LoadFixedWidth(dir, "extract.txt", spec, LoadOptions{})
+	if err != nil {
+		t.Fatal("Fixed Width: load failed", err)
+	}
+	if df.CountRecords() != 3 || df.FrameRecords[0].ConvertToFloat("Amount", df.Headers) != 1500.25 {
+		t.Error("Fixed Width: frame incorrect", df.FrameRecords)
+	}
+	if df.FrameRecords[0].Val("Id", df.Headers) != "12" || df.FrameRecords[1].Val("Name", df.Headers) != "Beth" {
+		t.Error("Fixed Width: values not trimmed", df.FrameRecords[0].Data)
+	}
+	if df.FrameRecords[2].Val("Name", df.Headers) != "Avery" || df.FrameRecords[2].Val("Amount", df.Headers) != "" {
+		t.Error("Fixed Width: short line values incorrect", df.FrameRecords[2].Data)
+	}
+	if len(short) != 1 || short[0].Line != 4 || short[0].Length != 10 {
+		t.Error("Fixed Width: short lines not reported", short)
+	}
+
+	spec.SkipShortLines = true
+	c := make(chan StreamingRecord)
+	shortc := make(chan []ShortLine, 1)
+	var total, read int64
+	var finished bool
+	progress := CallbackProgress{
+		OnStart:  func(_ string, n int64, _ ProgressUnit) { total = n },
+		OnAdd:    func(n int64) { read += n },
+		OnFinish: func() { finished = true },
+	}
+	go func() {
+		short, err := StreamFixedWidth(dir, "extract.txt", spec, c, LoadOptions{Progress: progress})
+		if err != nil {
+			t.Error("Fixed Width: stream failed", err)
+		}
+		shortc <- short
+	}()
+	rows := 0
+	for row := range c {
+		if row.Val("Name") == "Avery" {
+			t.Error("Fixed Width: short line was not skipped")
+		}
+		rows++
+	}
+	if rows != 2 || len(<-shortc) != 1 {
+		t.Error("Fixed Width: stream incorrect", rows)
+	}
+	if total != int64(len(data)) || read != total || !finished {
+		t.Error("Fixed Width: stream progress incorrect", total, read, finished)
+	}
+
+	if err := df.SaveFixedWidth(dir, "out.txt", spec, SaveOptions{}); err != nil {
+		t.Fatal("Fixed Width: save failed", err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "out.txt"))
+	want := "00012Kevin       1500.25\n00345Beth          12.00\n00007Avery              \n"
+	if string(raw) != want {
+		t.Errorf("Fixed Width: saved file incorrect\n%q\n%q", raw, want)
+	}
+
+	narrow := spec
+	narrow.Columns = []FixedWidthColumn{{Name: "Name", Start: 1, Width: 3}}
+	if err := df.SaveFixedWidth(dir, "narrow.txt", narrow, SaveOptions{}); err == nil {
+		t.Error("Fixed Width: long value should fail without truncation")
+	}
+	narrow.Truncate = true
+	narrow.LineEnding = "\r\n"
+	if err := df.SaveFixedWidth(dir, "narrow.txt", narrow, SaveOptions{}); err != nil {
+		t.Error("Fixed Width: truncation failed", err)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(dir, "narrow.txt")); string(raw) != "Kev\r\nBet\r\nAve\r\n" {
+		t.Errorf("Fixed Width: truncated file incorrect %q", raw)
+	}
+
+	overlap := FixedWidthSpec{Columns: []FixedWidthColumn{{Name: "Id", Start: 1, Width: 5}, {Name: "Name", Start: 4, Width: 5}}}
+	if err := df.SaveFixedWidth(dir, "overlap.txt", overlap, SaveOptions{}); err == nil {
+		t.Error("Fixed Width: overlapping columns should fail")
+	}
+	if _, _, err := LoadFixedWidth(dir, "extract.txt", FixedWidthSpec{}, LoadOptions{}); err == nil {
+		t.Error("Fixed Width: empty spec should fail")
+	}
+}
+
+func TestLoadProjection(t *testing.T) {
+	opts := LoadOptions{Columns: []string{"Last Name", "Cost"}}
+	df, err := CreateDataFrameWithOptions(".", "TestData.csv", opts)
+	if err != nil {
+		t.Fatal("Load Projection: load failed", err)
+	}
+	if len(df.Headers) != 2 || df.Headers["Last Name"] != 0 || df.Headers["Cost"] != 1 || len(df.FrameRecords[0].Data) != 2 {
+		t.Error("Load Projection: columns incorrect", df.Headers, df.FrameRecords[0].Data)
+	}
+	if df.CountRecords() != 10 || df.Sum("Cost") != 6521 {
+		t.Error("Load Projection: values incorrect", df.CountRecords(), df.Sum("Cost"))
+	}
+
+	opts = LoadOptions{SkipRows: 2, Limit: 3}
+	df, err = CreateDataFrameWithOptions(".", "TestData.csv", opts)
+	if err != nil || df.CountRecords() != 3 || df.FrameRecords[0].Val("First Name", df.Headers) != "Avery" {
+		t.Error("Load Projection: skip and limit incorrect", err, df.CountRecords())
+	}
+
+	var read int
+	opts = LoadOptions{
+		Columns: []string{"First Name"},
+		Where: func(row StreamingRecord) bool {
+			read++
+			return row.ConvertToInt("Cost") > 500
+		},
+		Limit: 2,
+	}
+	df, err = CreateDataFrameWithOptions(".", "TestData.csv", opts)
+	if err != nil || df.CountRecords() != 2 || len(df.Headers) != 1 {
+		t.Error("Load Projection: filter incorrect", err, df.CountRecords())
+	}
+	if read == 10 {
+		t.Error("Load Projection: reading did not stop at the limit")
+	}
+
+	c := make(chan StreamingRecord)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- StreamWithOptions(".", "TestData.csv", c, LoadOptions{Columns: []string{"Weight"}, Limit: 4})
+	}()
+	rows := 0
+	for row := range c {
+		if len(row.Data) != 1 {
+			t.Error("Load Projection: streamed row not projected", row.Data)
+		}
+		rows++
+	}
+	if err := <-errc; err != nil || rows != 4 {
+		t.Error("Load Projection: stream incorrect", rows, err)
+	}
+
+	if _, err := CreateDataFrameWithOptions(".", "TestData.csv", LoadOptions{Columns: []string{"Missing"}}); err == nil {
+		t.Error("Load Projection: missing column should fail")
+	}
+}
+
+func TestStreamChunks(t *testing.T) {
+	c := make(chan DataFrame)
+	errc := make(chan error, 1)
+	go func() { errc <- StreamChunks(".", "TestData.csv", 3, c, LoadOptions{}) }()
+
+	var sizes []int
+	var headers map[string]int
+	total := 0.0
+	for chunk := range c {
+		sizes = append(sizes, chunk.CountRecords())
+		total += chunk.Sum("Cost")
+		if headers == nil {
+			headers = chunk.Headers
+		} else if reflect.ValueOf(headers).Pointer() != reflect.ValueOf(chunk.Headers).Pointer() {
+			t.Error("Stream Chunks: chunks do not share the header map")
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("Stream Chunks: stream failed", err)
+	}
+	if !reflect.DeepEqual(sizes, []int{3, 3, 3, 1}) || total != 6521 {
+		t.Error("Stream Chunks: chunks incorrect", sizes, total)
+	}
+
+	c = make(chan DataFrame, 10)
+	if err := StreamChunks(".", "TestData.csv", 10, c, LoadOptions{Limit: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if chunk := <-c; chunk.CountRecords() != 5 {
+		t.Error("Stream Chunks: load options not applied", chunk.CountRecords())
+	}
+
+	if err := StreamChunks(".", "TestData.csv", 0, make(chan DataFrame), LoadOptions{}); err == nil {
+		t.Error("Stream Chunks: zero chunk size should fail")
+	}
+}
+
+func TestStreamContext(t *testing.T) {
+	rows, errc := StreamContext(context.Background(), ".", "TestData.csv", StreamOptions{BufferSize: 4})
+	if cap(rows) != 4 {
+		t.Error("Stream Context: buffer size not applied", cap(rows))
+	}
+	count := 0
+	for range rows {
+		count++
+	}
+	if err := <-errc; err != nil || count != 10 {
+		t.Error("Stream Context: stream incomplete", count, err)
+	}
+
+	// The consumer stops reading after two rows and cancels.
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, errc = StreamContext(ctx, ".", "TestData.csv", StreamOptions{})
+	<-rows
+	<-rows
+	cancel()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Error("Stream Context: cancellation error incorrect", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stream Context: stream did not stop after cancellation")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Bad.csv"), []byte("a,b\n1,2\n3,\"4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rows, errc = StreamContext(context.Background(), dir, "Bad.csv", StreamOptions{})
+	count = 0
+	for range rows {
+		count++
+	}
+	if err := <-errc; err == nil || count != 1 {
+		t.Error("Stream Context: bad row error not delivered", count, err)
+	}
+
+	rows, errc = StreamContext(context.Background(), dir, "Missing.csv", StreamOptions{})
+	if _, ok := <-rows; ok {
+		t.Error("Stream Context: missing file produced rows")
+	}
+	if err := <-errc; !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Stream Context: missing file error incorrect", err)
+	}
+}
+
+func TestPipelineStages(t *testing.T) {
+	ctx := context.Background()
+
+	df, err := PipelineFromFile(".", "TestData.csv", LoadOptions{}, PipelineOptions{Workers: 4, Ordered: true}).
+		Filter(func(row StreamingRecord) bool { return row.ConvertToInt("Cost") > 300 }).
+		WithColumn("Name", func(row StreamingRecord) string { return row.Val("First Name") + " " + row.Val("Last Name") }).
+		Select("ID", "Name", "Cost").
+		Rename("Cost", "Amount").
+		Collect(ctx)
+	if err != nil {
+		t.Fatal("Pipeline Stages: collect failed", err)
+	}
+
+	full := CreateDataFrame(".", "TestData.csv")
+	expected := CreateNewDataFrame(full.Columns())
+	for _, row := range full.FrameRecords {
+		if row.ConvertToInt("Cost", full.Headers) > 300 {
+			expected = expected.AddRecord(row.Data)
+		}
+	}
+
+	if df.CountRecords() != expected.CountRecords() || len(df.Headers) != 3 || df.Headers["Amount"] != 2 {
+		t.Fatal("Pipeline Stages: result incorrect", df.CountRecords(), df.Headers)
+	}
+	for i, row := range df.FrameRecords {
+		want := expected.FrameRecords[i]
+		if row.Val("ID", df.Headers) != want.Val("ID", expected.Headers) {
+			t.Error("Pipeline Stages: order not kept", i, row.Data)
+		}
+		if row.Val("Name", df.Headers) != want.Val("First Name", expected.Headers)+" "+want.Val("Last Name", expected.Headers) {
+			t.Error("Pipeline Stages: computed column incorrect", row.Data)
+		}
+	}
+
+	// Every last name is Fultz except a few, so dedupe keeps the first row for each.
+	seen := map[string]bool{}
+	var firstIDs []string
+	for _, row := range full.FrameRecords {
+		name := row.Val("Last Name", full.Headers)
+		if !seen[name] {
+			seen[name] = true
+			firstIDs = append(firstIDs, row.Val("ID", full.Headers))
+		}
+	}
+	p := PipelineFromFrame(full, PipelineOptions{Workers: 3, Ordered: true}).Dedupe("Last Name")
+	for run := 0; run < 2; run++ {
+		var ids []string
+		err := p.ForEach(ctx, func(row StreamingRecord) error {
+			ids = append(ids, row.Val("ID"))
+			return nil
+		})
+		if err != nil || !reflect.DeepEqual(ids, firstIDs) {
+			t.Error("Pipeline Stages: dedupe incorrect", run, ids, firstIDs, err)
+		}
+	}
+
+	_, err = PipelineFromFrame(full, PipelineOptions{}).Select("Missing").Collect(ctx)
+	if err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Error("Pipeline Stages: stage error not returned", err)
+	}
+}
+
+type costTotal struct {
+	rows int
+	cost float64
+}
+
+func (a *costTotal) Add(row StreamingRecord) error {
+	a.rows++
+	a.cost += row.ConvertToFloat("Cost")
+	return nil
+}
+
+func TestPipelineSinks(t *testing.T) {
+	ctx := context.Background()
+	full := CreateDataFrame(".", "TestData.csv")
+
+	var sizes []int
+	err := PipelineFromFrame(full, PipelineOptions{}).Batch(ctx, 4, func(batch DataFrame) error {
+		sizes = append(sizes, batch.CountRecords())
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(sizes, []int{4, 4, 2}) {
+		t.Error("Pipeline Sinks: batches incorrect", sizes, err)
+	}
+
+	agg := &costTotal{}
+	if err := PipelineFromFile(".", "TestData.csv", LoadOptions{}, PipelineOptions{Workers: 2}).Aggregate(ctx, agg); err != nil {
+		t.Fatal(err)
+	}
+	if agg.rows != 10 || agg.cost != 6521 {
+		t.Error("Pipeline Sinks: aggregate incorrect", agg.rows, agg.cost)
+	}
+
+	dir := t.TempDir()
+	err = PipelineFromFrame(full, PipelineOptions{Workers: 2, Ordered: true}).
+		Select("First Name", "Weight").
+		WriteCSV(ctx, dir, "Out", SaveOptions{})
+	if err != nil {
+		t.Fatal("Pipeline Sinks: write failed", err)
+	}
+	written := CreateDataFrame(dir, "Out")
+	if written.CountRecords() != 10 || written.Sum("Weight") != 3376 || written.Columns()[0] != "First Name" {
+		t.Error("Pipeline Sinks: written file incorrect", written.Columns())
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `orders`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 6))
+	mock.ExpectPrepare("INSERT INTO `orders`").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 4))
+
+	report, err := PipelineFromFrame(full, PipelineOptions{}).
+		BulkUpload(ctx, db, "orders", BulkUploadOptions{Columns: full.Columns(), RowsPerBatch: 6, CreateTable: true})
+	if err != nil || report.RowsInserted != 10 || report.Batches != 2 {
+		t.Error("Pipeline Sinks: bulk upload incorrect", report, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPipelineStopsEarly(t *testing.T) {
+	var produced atomic.Int64
+	source := func(ctx context.Context, out chan<- StreamingRecord) error {
+		headers := map[string]int{"n": 0}
+		for i := 0; ; i++ {
+			select {
+			case out <- StreamingRecord{Data: []string{strconv.Itoa(i)}, Headers: headers}:
+				produced.Add(1)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	stop := errors.New("stop")
+	rows := 0
+	err := NewPipeline(source, PipelineOptions{Workers: 4, Ordered: true}).
+		Filter(func(row StreamingRecord) bool { return true }).
+		ForEach(context.Background(), func(row StreamingRecord) error {
+			rows++
+			if rows == 100 {
+				return stop
+			}
+			return nil
+		})
+	if !errors.Is(err, stop) || rows != 100 {
+		t.Error("Pipeline Stops Early: sink error not returned", err, rows)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = NewPipeline(source, PipelineOptions{Workers: 2}).ForEach(ctx, func(StreamingRecord) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Pipeline Stops Early: cancellation error incorrect", err)
+	}
+}
+
+func TestGroupByAggregations(t *testing.T) {
+	full := CreateDataFrame(".", "TestData.csv")
+	aggregations := []Aggregation{
+		{Func: AggSum, Column: "Cost"},
+		{Func: AggCount},
+		{Func: AggMin, Column: "Weight"},
+		{Func: AggMax, Column: "Weight"},
+		{Func: AggMean, Column: "Cost", As: "Average Cost"},
+		{Func: AggDistinct, Column: "First Name"},
+		{Func: AggQuantile, Column: "Cost", Quantile: 0.5},
+	}
+
+	c := make(chan StreamingRecord)
+	go Stream(".", "TestData.csv", c)
+	result, err := AggregateStream(c, []string{"Last Name"}, aggregations...)
+	if err != nil {
+		t.Fatal("Group By: aggregate failed", err)
+	}
+
+	expected := []string{"Last Name", "Sum Cost", "Count", "Min Weight", "Max Weight", "Average Cost", "Distinct First Name", "P50 Cost"}
+	if !reflect.DeepEqual(result.Columns(), expected) {
+		t.Error("Group By: columns incorrect", result.Columns())
+	}
+
+	lastNames := full.Unique("Last Name")
+	if result.CountRecords() != len(lastNames) {
+		t.Fatal("Group By: group count incorrect", result.CountRecords(), lastNames)
+	}
+	for _, row := range result.FrameRecords {
+		name := row.Val("Last Name", result.Headers)
+		group := full.Filtered("Last Name", name)
+
+		if row.ConvertToFloat("Sum Cost", result.Headers) != group.Sum("Cost") ||
+			row.ConvertToInt("Count", result.Headers) != int64(group.CountRecords()) ||
+			row.ConvertToFloat("Min Weight", result.Headers) != group.Min("Weight") ||
+			row.ConvertToFloat("Max Weight", result.Headers) != group.Max("Weight") ||
+			math.Abs(row.ConvertToFloat("Average Cost", result.Headers)-group.Average("Cost")) > 1e-9 {
+			t.Error("Group By: values incorrect", name, row.Data)
+		}
+		if row.ConvertToInt("Distinct First Name", result.Headers) != int64(len(group.Unique("First Name"))) {
+			t.Error("Group By: distinct count incorrect", name, row.Data)
+		}
+	}
+
+	chunks := make(chan DataFrame)
+	go StreamChunks(".", "TestData.csv", 3, chunks, LoadOptions{})
+	total, err := AggregateChunks(chunks, nil, Aggregation{Func: AggSum, Column: "Cost"}, Aggregation{Func: AggCount})
+	if err != nil || total.CountRecords() != 1 || total.FrameRecords[0].Val("Sum Cost", total.Headers) != "6521" ||
+		total.FrameRecords[0].Val("Count", total.Headers) != "10" {
+		t.Error("Group By: chunk totals incorrect", total.FrameRecords, err)
+	}
+
+	c = make(chan StreamingRecord)
+	go Stream(".", "TestData.csv", c)
+	if _, err := AggregateStream(c, nil, Aggregation{Func: AggSum, Column: "First Name"}); err == nil {
+		t.Error("Group By: text in a numeric aggregation should fail")
+	}
+	if _, err := NewGroupBy(nil, Aggregation{Func: AggSum}); err == nil {
+		t.Error("Group By: missing column should fail")
+	}
+}
+
+func TestGroupByApproximations(t *testing.T) {
+	g, err := NewGroupBy(nil,
+		Aggregation{Func: AggDistinct, Column: "id"},
+		Aggregation{Func: AggQuantile, Column: "n", Quantile: 0.5},
+		Aggregation{Func: AggQuantile, Column: "n", Quantile: 0.95},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]int{"id": 0, "n": 1}
+	values := rand.New(rand.NewSource(1)).Perm(100000)
+	for i, v := range values {
+		// Every id appears twice so only half of the rows are distinct.
+		id := strconv.Itoa(i / 2)
+		if err := g.Add(StreamingRecord{Data: []string{id, strconv.Itoa(v)}, Headers: headers}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := g.Result()
+	row := result.FrameRecords[0]
+	if distinct := row.ConvertToFloat("Distinct id", result.Headers); math.Abs(distinct-50000)/50000 > 0.05 {
+		t.Error("Group By Approximations: distinct estimate too far off", distinct)
+	}
+	if median := row.ConvertToFloat("P50 n", result.Headers); math.Abs(median-50000) > 1000 {
+		t.Error("Group By Approximations: median estimate too far off", median)
+	}
+	if p95 := row.ConvertToFloat("P95 n", result.Headers); math.Abs(p95-95000) > 1000 {
+		t.Error("Group By Approximations: p95 estimate too far off", p95)
+	}
+
+	// Small groups are counted exactly without allocating the registers.
+	var h hyperLogLog
+	for i := 0; i < hllSparseLimit; i++ {
+		h.add(uint64(i) * 0x9e3779b97f4a7c15)
+		h.add(uint64(i) * 0x9e3779b97f4a7c15)
+	}
+	if h.registers != nil || h.estimate() != hllSparseLimit {
+		t.Error("Group By Approximations: small distinct count incorrect", h.estimate())
+	}
+	h.add(math.MaxUint64)
+	if h.registers == nil || math.Abs(h.estimate()-hllSparseLimit-1) > 2 {
+		t.Error("Group By Approximations: switch to registers incorrect", h.estimate())
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	dir := t.TempDir()
+	full := CreateDataFrame(".", "TestData.csv")
+
+	w, err := NewStreamWriter(dir, "Out", []string{"Last Name", "Cost"}, StreamWriterOptions{FlushEvery: 2})
+	if err != nil {
+		t.Fatal("Stream Writer: create failed", err)
+	}
+
+	c := make(chan StreamingRecord)
+	go Stream(".", "TestData.csv", c)
+	for row := range c {
+		if err := w.Write(row); err != nil {
+			t.Fatal("Stream Writer: write failed", err)
+		}
+	}
+
+	// Rows are flushed periodically so the file grows before Close.
+	if info, err := os.Stat(filepath.Join(dir, "Out.csv")); err != nil || info.Size() == 0 {
+		t.Error("Stream Writer: rows not flushed before close", err)
+	}
+	if err := w.WriteFrame(full); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil || w.Rows() != 20 {
+		t.Fatal("Stream Writer: close failed", w.Rows(), err)
+	}
+	if err := w.Write(StreamingRecord{Data: full.FrameRecords[0].Data, Headers: full.Headers}); err == nil {
+		t.Error("Stream Writer: write after close should fail")
+	}
+
+	out := CreateDataFrame(dir, "Out")
+	if !reflect.DeepEqual(out.Columns(), []string{"Last Name", "Cost"}) || out.CountRecords() != 20 || out.Sum("Cost") != 13042 {
+		t.Error("Stream Writer: written file incorrect", out.Columns(), out.CountRecords())
+	}
+
+	// Appending adopts the existing header and rejects a different one.
+	w, err = NewStreamWriter(dir, "Out", nil, StreamWriterOptions{Append: true})
+	if err != nil {
+		t.Fatal("Stream Writer: append failed", err)
+	}
+	if err := w.WriteRecord(full.FrameRecords[0], full.Headers); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out := CreateDataFrame(dir, "Out"); out.CountRecords() != 21 {
+		t.Error("Stream Writer: append incorrect", out.CountRecords())
+	}
+	if _, err := NewStreamWriter(dir, "Out", []string{"Cost", "Last Name"}, StreamWriterOptions{Append: true}); err == nil {
+		t.Error("Stream Writer: mismatched header should fail")
+	}
+
+	// Appending to compressed files and in-memory storage.
+	storage := NewMemoryStorage()
+	for i := 0; i < 2; i++ {
+		opts := StreamWriterOptions{Append: true, SaveOptions: SaveOptions{Storage: storage, Compression: CompressionGzip}}
+		w, err := NewStreamWriter("logs", "Daily", nil, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteFrame(full); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	daily, err := CreateDataFrameWithOptions("logs", "Daily.csv.gz", LoadOptions{Storage: storage})
+	if err != nil || daily.CountRecords() != 20 || daily.Sum("Weight") != 6752 {
+		t.Error("Stream Writer: compressed append incorrect", daily.CountRecords(), err)
+	}
+
+	// Appending to a tab separated file keeps its name and reads the header with tabs.
+	for i := 0; i < 2; i++ {
+		w, err := NewStreamWriter(dir, "out.tsv", []string{"a", "b"}, StreamWriterOptions{Format: FormatTSV, Append: true})
+		if err != nil {
+			t.Fatal("Stream Writer: tsv append failed", err)
+		}
+		if err := w.WriteRecord(Record{Data: []string{"1", "2"}}, map[string]int{"a": 0, "b": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "out.tsv")); err != nil || string(data) != "a\tb\n1\t2\n1\t2\n" {
+		t.Error("Stream Writer: tsv append incorrect", string(data), err)
+	}
+
+	w, err = NewStreamWriter(dir, "Missing", []string{"Nope"}, StreamWriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(full); err == nil {
+		t.Error("Stream Writer: missing column should fail")
+	}
+	w.Close()
+}
+
+func TestLoadFramesContext(t *testing.T) {
+	ctx := context.Background()
+	files := []string{"TestData.csv", "Missing.csv", "TestMergeData.csv", "AlsoMissing.csv", "TestDataConcat.csv"}
+
+	results, err := LoadFramesContext(ctx, "./", files, LoadFramesOptions{Workers: 2, CollectErrors: true})
+	if err == nil || !strings.Contains(err.Error(), "Missing.csv") || !strings.Contains(err.Error(), "AlsoMissing.csv") {
+		t.Error("Load Frames Context: errors not collected", err)
+	}
+	if len(results) != len(files) {
+		t.Fatal("Load Frames Context: result count incorrect", len(results))
+	}
+	for i, result := range results {
+		if result.File != files[i] {
+			t.Error("Load Frames Context: result paired with the wrong file", i, result.File)
+		}
+	}
+	if results[0].Err != nil || results[0].Frame.Sum("Weight") != 3376 {
+		t.Error("Load Frames Context: TestData.csv incorrect", results[0].Err)
+	}
+	if results[2].Err != nil || results[2].Frame.Sum("Postal Code") != 495735 {
+		t.Error("Load Frames Context: TestMergeData.csv incorrect", results[2].Err)
+	}
+	if !errors.Is(results[1].Err, fs.ErrNotExist) || !errors.Is(results[3].Err, fs.ErrNotExist) {
+		t.Error("Load Frames Context: per file errors incorrect", results[1].Err, results[3].Err)
+	}
+
+	// Fail fast returns the first failure only.
+	_, err = LoadFramesContext(ctx, "./", files, LoadFramesOptions{Workers: 1})
+	if err == nil || !strings.Contains(err.Error(), "Missing.csv") || strings.Contains(err.Error(), "AlsoMissing.csv") {
+		t.Error("Load Frames Context: fail fast error incorrect", err)
+	}
+
+	// Many workers and more files than workers keep every frame with its file.
+	many := []string{}
+	for i := 0; i < 20; i++ {
+		many = append(many, []string{"TestData.csv", "TestMergeData.csv"}[i%2])
+	}
+	results, err = LoadFramesContext(ctx, "./", many, LoadFramesOptions{Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if _, ok := result.Frame.Headers["Postal Code"]; ok != (i%2 == 1) {
+			t.Error("Load Frames Context: frame paired with the wrong file", i)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	results, err = LoadFramesContext(cancelled, "./", []string{"TestData.csv", "TestMergeData.csv"}, LoadFramesOptions{})
+	if !errors.Is(err, context.Canceled) || !errors.Is(results[0].Err, context.Canceled) {
+		t.Error("Load Frames Context: cancellation not reported", err)
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := map[string]string{
+		"2024-01/sales.csv": "ID,Amount\n1,10\n2,20\n",
+		"2024-02/sales.csv": "Amount,ID,Region\n30,3,East\n",
+		"2024-02/notes.txt": "not a csv",
+		"top.csv":           "ID,Amount\n4,40\n",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := LoadDirectory(ctx, dir, "*.csv", LoadFilesOptions{})
+	if err != nil || len(results) != 1 || results[0].Frame.Sum("Amount") != 40 {
+		t.Error("Load Directory: subdirectories should not be searched", err, len(results))
+	}
+
+	results, err = LoadDirectory(ctx, dir, "*.csv", LoadFilesOptions{Recursive: true})
+	if err != nil || len(results) != 3 {
+		t.Fatal("Load Directory: recursive search incorrect", err, len(results))
+	}
+	if !strings.HasSuffix(results[0].File, "2024-01/sales.csv") || !strings.HasSuffix(results[2].File, "top.csv") {
+		t.Error("Load Directory: results not in file name order", results[0].File, results[2].File)
+	}
+
+	results, err = LoadGlob(ctx, filepath.Join(dir, "2024-*", "sales.csv"), LoadFilesOptions{})
+	if err != nil || len(results) != 2 {
+		t.Error("Load Glob: matched files incorrect", err, len(results))
+	}
+
+	// Identical schemas allow the columns in a different order but not extra columns.
+	_, err = UnionGlob(ctx, filepath.Join(dir, "2024-*", "sales.csv"), LoadFilesOptions{})
+	if err == nil || !strings.Contains(err.Error(), "Region") {
+		t.Error("Union Glob: differing columns not reported", err)
+	}
+	df, err := UnionDirectory(ctx, dir, "*.csv", LoadFilesOptions{Recursive: true, Schema: SchemaIntersection, SourceColumn: "Source"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(df.Columns(), []string{"ID", "Amount", "Source"}) || df.Sum("Amount") != 100 {
+		t.Error("Union Directory: intersection incorrect", df.Columns(), df.Sum("Amount"))
+	}
+	if df.FrameRecords[2].Val("ID", df.Headers) != "3" || !strings.HasSuffix(df.FrameRecords[2].Val("Source", df.Headers), "2024-02/sales.csv") {
+		t.Error("Union Directory: rows not aligned to columns", df.FrameRecords[2].Data)
+	}
+
+	df, err = UnionDirectory(ctx, dir, "*.csv", LoadFilesOptions{Recursive: true, Schema: SchemaUnion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(df.Columns(), []string{"ID", "Amount", "Region"}) || df.CountRecords() != 4 {
+		t.Error("Union Directory: union incorrect", df.Columns(), df.CountRecords())
+	}
+	if df.FrameRecords[0].Val("Region", df.Headers) != "" || df.FrameRecords[2].Val("Region", df.Headers) != "East" {
+		t.Error("Union Directory: missing values not filled", df.FrameRecords[0].Data, df.FrameRecords[2].Data)
+	}
+
+	// Works with any storage.
+	storage := NewMemoryStorage()
+	for name, data := range files {
+		w, _ := storage.Create("exports/" + name)
+		w.Write([]byte(data))
+		w.Close()
+	}
+	df, err = UnionGlob(ctx, "exports/*/sales.csv", LoadFilesOptions{LoadFramesOptions: LoadFramesOptions{LoadOptions: LoadOptions{Storage: storage}}, Schema: SchemaUnion, SourceColumn: "Source"})
+	if err != nil || df.CountRecords() != 3 || df.FrameRecords[2].Val("Source", df.Headers) != "exports/2024-02/sales.csv" {
+		t.Error("Union Glob: memory storage incorrect", err, df.FrameRecords)
+	}
+
+	// With collected errors the files that loaded are still combined.
+	w, _ := storage.Create("exports/2024-03/sales.csv")
+	w.Write([]byte("ID,Amount\n\"5,50\n"))
+	w.Close()
+	collect := LoadFilesOptions{LoadFramesOptions: LoadFramesOptions{LoadOptions: LoadOptions{Storage: storage}, CollectErrors: true}, Schema: SchemaUnion}
+	df, err = UnionGlob(ctx, "exports/*/sales.csv", collect)
+	if err == nil || !strings.Contains(err.Error(), "2024-03") || df.CountRecords() != 3 {
+		t.Error("Union Glob: collected errors incorrect", err, df.CountRecords())
+	}
+	collect.CollectErrors = false
+	if df, err = UnionGlob(ctx, "exports/*/sales.csv", collect); err == nil || df.CountRecords() != 0 {
+		t.Error("Union Glob: failed file should fail the union", err, df.CountRecords())
+	}
+
+	_, err = LoadDirectory(ctx, dir, "*.json", LoadFilesOptions{})
+	if err == nil {
+		t.Error("Load Directory: no matching files should error")
+	}
+	_, err = UnionDirectory(ctx, dir, "*.csv", LoadFilesOptions{SourceColumn: "ID"})
+	if err == nil {
+		t.Error("Union Directory: source column clash should error")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	path := "./"
+	df := CreateDataFrame(path, "TestData.csv")
+
+	parts, err := df.Split(3)
+	if err != nil || len(parts) != 3 {
+		t.Fatal("Split: part count incorrect", err, len(parts))
+	}
+	if parts[0].CountRecords()+parts[1].CountRecords()+parts[2].CountRecords() != 10 {
+		t.Error("Split: rows lost")
+	}
+	if &parts[1].FrameRecords[0].Data[0] != &df.FrameRecords[parts[0].CountRecords()].Data[0] {
+		t.Error("Split: rows were copied")
+	}
+	parts[0].NewField("Extra")
+	if _, ok := df.Headers["Extra"]; ok {
+		t.Error("Split: header map shared with the original frame")
+	}
+	if parts, _ := df.Split(50); len(parts) != 10 {
+		t.Error("Split: more parts than rows", len(parts))
+	}
+
+	// Results are stacked in the original order.
+	doubled, err := df.Parallel(4, func(part DataFrame) (DataFrame, error) {
+		out := CreateNewDataFrame([]string{"ID", "Double Cost"})
+		for _, row := range part.FrameRecords {
+			out = out.AddRecord([]string{row.Val("ID", part.Headers), strconv.FormatFloat(row.ConvertToFloat("Cost", part.Headers)*2, 'f', -1, 64)})
+		}
+		return out, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doubled.Sum("Double Cost") != 13042 || doubled.CountRecords() != 10 {
+		t.Error("Parallel: results incorrect", doubled.Sum("Double Cost"))
+	}
+	for i, row := range doubled.FrameRecords {
+		if row.Val("ID", doubled.Headers) != df.FrameRecords[i].Val("ID", df.Headers) {
+			t.Error("Parallel: order not kept", i)
+		}
+	}
+
+	_, err = df.Parallel(3, func(part DataFrame) (DataFrame, error) {
+		if part.FrameRecords[0].Val("ID", part.Headers) != df.FrameRecords[0].Val("ID", df.Headers) {
+			return DataFrame{}, errors.New("boom")
+		}
+		return part, nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "part 2") {
+		t.Error("Parallel: error not returned", err)
+	}
+	_, err = df.Parallel(3, func(part DataFrame) (DataFrame, error) {
+		if part.FrameRecords[0].Val("ID", part.Headers) == df.FrameRecords[0].Val("ID", df.Headers) {
+			return part.KeepColumns([]string{"ID"}), nil
+		}
+		return part, nil
+	})
+	if err == nil {
+		t.Error("Parallel: differing columns should error")
+	}
+
+	total, err := ParallelReduce(df, 0, func(part DataFrame) (float64, error) {
+		return part.Sum("Cost"), nil
+	}, func(a, b float64) float64 { return a + b })
+	if err != nil || total != 6521 {
+		t.Error("Parallel Reduce: total incorrect", total, err)
+	}
+
+	// Every row of a group is seen by the same call.
+	counts, err := df.ParallelByKey("Last Name", 3, func(part DataFrame) (DataFrame, error) {
+		out := CreateNewDataFrame([]string{"Last Name", "Count"})
+		for _, name := range part.Unique("Last Name") {
+			out = out.AddRecord([]string{name, strconv.Itoa(len(part.Filtered("Last Name", name).FrameRecords))})
+		}
+		return out, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts.Unique("Last Name")) != counts.CountRecords() || counts.Sum("Count") != 10 {
+		t.Error("Parallel By Key: groups were split", counts.FrameRecords)
+	}
+	if fultz := counts.Filtered("Last Name", "Fultz"); fultz.FrameRecords[0].Val("Count", counts.Headers) != "3" {
+		t.Error("Parallel By Key: Fultz count incorrect")
+	}
+
+	largest, err := ParallelReduceByKey(df, "Last Name", 2, func(part DataFrame) (int, error) {
+		return part.CountRecords(), nil
+	}, func(a, b int) int { return a + b })
+	if err != nil || largest != 10 {
+		t.Error("Parallel Reduce By Key: total incorrect", largest, err)
+	}
+	if _, err := df.SplitByKey("Missing", 2); err == nil {
+		t.Error("Split By Key: missing column should error")
+	}
+}
+
+func TestViews(t *testing.T) {
+	path := "./"
+	df := CreateDataFrame(path, "TestData.csv")
+
+	head := df.Head(3)
+	if head.Len() != 3 || head.Val(0, "ID") != df.FrameRecords[0].Val("ID", df.Headers) {
+		t.Error("Head: rows incorrect", head.Len())
+	}
+	if &head.Row(0).Data[0] != &df.FrameRecords[0].Data[0] {
+		t.Error("Head: rows were copied")
+	}
+	tail := df.Tail(2)
+	if tail.Len() != 2 || tail.Val(1, "ID") != df.FrameRecords[9].Val("ID", df.Headers) {
+		t.Error("Tail: rows incorrect", tail.Len())
+	}
+	if df.Tail(50).Len() != 10 || df.Slice(8, 50).Len() != 2 || df.Slice(5, 2).Len() != 0 {
+		t.Error("Slice: bounds not clamped")
+	}
+
+	// Views of views keep referring to the parent's rows.
+	middle := df.Slice(2, 8).Slice(1, 3)
+	if middle.Len() != 2 || middle.Val(0, "ID") != df.FrameRecords[3].Val("ID", df.Headers) {
+		t.Error("Slice: nested slice incorrect", middle.Val(0, "ID"))
+	}
+
+	taken, err := df.Take(9, 0, 9)
+	if err != nil || taken.Len() != 3 || taken.Val(0, "ID") != taken.Val(2, "ID") || taken.Val(1, "ID") != df.FrameRecords[0].Val("ID", df.Headers) {
+		t.Error("Take: rows incorrect", err)
+	}
+	if _, err := df.Take(10); err == nil {
+		t.Error("Take: out of range position should error")
+	}
+
+	fultz := df.View().Filtered("Last Name", "Fultz")
+	if fultz.Len() != 3 || fultz.Unique("Last Name")[0] != "Fultz" {
+		t.Error("View Filtered: rows incorrect", fultz.Len())
+	}
+	if filtered := df.Filtered("Last Name", "Fultz"); fultz.Sum("Cost") != filtered.Sum("Cost") {
+		t.Error("View Filtered: sum incorrect", fultz.Sum("Cost"))
+	}
+	others := df.View().Exclude("Last Name", "Fultz", "Wiedmann")
+	if others.Len() != 5 {
+		t.Error("View Exclude: rows incorrect", others.Len())
+	}
+	cheap := fultz.Filter(func(row StreamingRecord) bool { return row.ConvertToFloat("Cost") < 1000 }).Head(1)
+	if cheap.Len() > 1 || df.View().Sum("Cost") != 6521 {
+		t.Error("View Filter: rows incorrect", cheap.Len())
+	}
+
+	// Views see updates made to the parent while materialized frames do not.
+	materialized := fultz.Materialize()
+	fultz.Row(0).Update("First Name", "Changed", df.Headers)
+	if fultz.Val(0, "First Name") != "Changed" || materialized.FrameRecords[0].Val("First Name", materialized.Headers) == "Changed" {
+		t.Error("Materialize: data shared with the parent")
+	}
+	if !reflect.DeepEqual(materialized.Columns(), df.Columns()) || materialized.CountRecords() != 3 {
+		t.Error("Materialize: frame incorrect", materialized.Columns())
+	}
+
+	// Frames built from a view can be appended to without changing the parent.
+	frame := df.Head(2).Frame()
+	frame = frame.AddRecord(make([]string, len(df.Headers)))
+	if df.FrameRecords[2].Val("ID", df.Headers) == "" {
+		t.Error("View Frame: append overwrote the parent")
+	}
+}
+
+func TestLazy(t *testing.T) {
+	ctx := context.Background()
+	path := "./"
+	df := CreateDataFrame(path, "TestData.csv")
+
+	// Filters and selections end up in the csv reader.
+	query := ScanCSV(path, "TestData", LoadOptions{}).
+		Select("ID", "Cost", "Last Name").
+		Filtered("Last Name", "Fultz").
+		Select("Cost")
+	plan, err := query.Explain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan != "Scan csv TestData.csv columns=[Cost] filter=[Last Name in [Fultz]]\n" {
+		t.Error("Lazy Explain: plan not optimized", plan)
+	}
+	result, err := query.Collect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := df.Filtered("Last Name", "Fultz")
+	if !reflect.DeepEqual(result.Columns(), []string{"Cost"}) || result.Sum("Cost") != expected.Sum("Cost") {
+		t.Error("Lazy Collect: result incorrect", result.Columns(), result.Sum("Cost"))
+	}
+
+	// Filters stay above a limit and sorts run on the filtered rows.
+	query = df.Lazy().Limit(8).GreaterThanOrEqualTo("Cost", 500).Sort("Cost", false).Select("ID", "Cost")
+	plan, _ = query.Explain()
+	if plan != "Sort Cost descending\n  Select [ID Cost]\n    Filter Cost >= 500\n      Scan frame (10 rows) limit=8\n" {
+		t.Error("Lazy Explain: filter moved past the limit", plan)
+	}
+	result, err = query.Collect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := df.Head(8).Frame()
+	eager, _ := head.GreaterThanOrEqualTo("Cost", 500)
+	eager.Sort("Cost", false)
+	if result.CountRecords() != eager.CountRecords() || result.FrameRecords[0].Val("ID", result.Headers) != eager.FrameRecords[0].Val("ID", eager.Headers) {
+		t.Error("Lazy Collect: sorted result incorrect", result.FrameRecords)
+	}
+
+	// Sorting before a filter can differ from sorting after it, so the optimized plan must match the
+	// plan as written.
+	mixed := CreateNewDataFrame([]string{"V"}).AddRecord([]string{"10"}).AddRecord([]string{"9"}).AddRecord([]string{"abc"})
+	query = mixed.Lazy().Sort("V", true).Exclude("V", "abc")
+	result, err = query.Collect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, _, err := prepare(query.plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unoptimized, err := execute(ctx, written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Unique("V"), []string{"10", "9"}) || !reflect.DeepEqual(result, unoptimized) {
+		t.Error("Lazy Collect: filter moved below a sort", result.FrameRecords, unoptimized.FrameRecords)
+	}
+
+	// Selections are split across the join inputs and filters move to the input they read.
+	joined := ScanCSV(path, "TestData.csv", LoadOptions{}).
+		Join(ScanCSV(path, "TestMergeData.csv", LoadOptions{}), "ID").
+		Filtered("State", "WI", "WA").
+		Filtered("Last Name", "Fultz").
+		Select("First Name", "City")
+	plan, _ = joined.Explain()
+	expectedPlan := "Select [First Name City]\n" +
+		"  Join inner on ID\n" +
+		"    Scan csv TestData.csv columns=[ID First Name] filter=[Last Name in [Fultz]]\n" +
+		"    Scan csv TestMergeData.csv columns=[ID City] filter=[State in [WI WA]]\n"
+	if plan != expectedPlan {
+		t.Error("Lazy Explain: join plan incorrect", plan)
+	}
+	result, err = joined.Collect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	right := CreateDataFrame(path, "TestMergeData.csv")
+	eager, _ = expected.InnerMerge(&right, "ID")
+	eager = eager.Filtered("State", "WI", "WA").KeepColumns([]string{"First Name", "City"})
+	if !reflect.DeepEqual(result, eager) {
+		t.Error("Lazy Collect: join result incorrect", result, eager)
+	}
+
+	// Left joins only add the selected columns.
+	left, err := df.Lazy().LeftJoin(right.Lazy(), "ID").Select("ID", "Postal Code").Collect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(left.Columns(), []string{"ID", "Postal Code"}) || left.CountRecords() != 10 || left.FrameRecords[0].Val("Postal Code", left.Headers) != "54911" {
+		t.Error("Lazy Collect: left join incorrect", left.Columns(), left.FrameRecords)
+	}
+	if df.Columns()[len(df.Columns())-1] != "Last Name" {
+		t.Error("Lazy Collect: source frame changed", df.Columns())
+	}
+
+	if _, err := df.Lazy().Select("Missing").Collect(ctx); err == nil {
+		t.Error("Lazy Collect: missing column should error")
+	}
+	if _, err := ScanCSV(path, "Missing.csv", LoadOptions{}).Collect(ctx); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Lazy Collect: missing file not reported", err)
+	}
+
+	// The header is read with the encoding of the options.
+	dir := t.TempDir()
+	utf16le, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().String("Name,Age\r\nJosé,42\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "utf16.csv"), []byte(utf16le), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = ScanCSV(dir, "utf16.csv", LoadOptions{Encoding: EncodingUTF16LE}).Select("Name").Collect(ctx)
+	if err != nil || result.CountRecords() != 1 || result.FrameRecords[0].Data[0] != "José" {
+		t.Error("Lazy Collect: encoding of the options ignored", err, result.FrameRecords)
+	}
+}
+
+func TestQueryContext(t *testing.T) {
+	path := "./"
+	q := NewQueryContext()
+	q.Register("orders", CreateDataFrame(path, "TestData.csv"))
+	q.Register("cities", CreateDataFrame(path, "TestMergeData.csv"))
+
+	if !reflect.DeepEqual(q.Tables(), []string{"cities", "orders"}) {
+		t.Error("Query Context: tables incorrect", q.Tables())
+	}
+
+	df, err := q.Query(`SELECT "Last Name", COUNT(*) AS Orders, SUM(Cost), AVG(Cost) AS Average
+		FROM orders
+		WHERE Cost >= 100 AND "Last Name" IN ('Fultz', 'Wiedmann', 'Curtis')
+		GROUP BY "Last Name"
+		HAVING COUNT(*) > 1
+		ORDER BY SUM(Cost) DESC`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(df.Columns(), []string{"Last Name", "Orders", "SUM(Cost)", "Average"}) {
+		t.Error("Query: columns incorrect", df.Columns())
+	}
+	expected := [][]string{{"Fultz", "3", "2088", "696"}, {"Wiedmann", "2", "895", "447.5"}}
+	if df.CountRecords() != 2 || !reflect.DeepEqual(df.FrameRecords[0].Data, expected[0]) || !reflect.DeepEqual(df.FrameRecords[1].Data, expected[1]) {
+		t.Error("Query: grouped result incorrect", df.FrameRecords)
+	}
+
+	// Joins, expressions, ordering on columns that are not selected, LIMIT and OFFSET.
+	df, err = q.Query(`SELECT o.ID, c.City, Cost * 2 AS Double
+		FROM orders o JOIN cities AS c ON o.ID = c.ID
+		WHERE c.State LIKE 'w%' OR [First Name] = 'Nick'
+		ORDER BY Weight
+		LIMIT 2 OFFSET 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(df.Columns(), []string{"ID", "City", "Double"}) || df.CountRecords() != 2 {
+		t.Fatal("Query: join columns incorrect", df.Columns(), df.FrameRecords)
+	}
+	if df.FrameRecords[0].Val("City", df.Headers) != "RICHLAND" || df.FrameRecords[1].Val("Double", df.Headers) != "1748" {
+		t.Error("Query: join result incorrect", df.FrameRecords)
+	}
+
+	// Left joins keep unmatched rows with empty values.
+	q.Register("vip", CreateNewDataFrame([]string{"ID", "Level"}).AddRecord([]string{"3", "Gold"}).AddRecord([]string{"3", "Silver"}))
+	df, err = q.Query(`SELECT orders.ID, vip.Level FROM orders LEFT JOIN vip ON vip.ID = orders.ID AND Cost > 0 ORDER BY 1 DESC, Level`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if df.CountRecords() != 11 || df.FrameRecords[0].Val("ID", df.Headers) != "10" || df.FrameRecords[7].Val("Level", df.Headers) != "Gold" {
+		t.Error("Query: left join incorrect", df.FrameRecords)
+	}
+	df, err = q.Query(`SELECT COUNT(Level), COUNT(DISTINCT orders.ID) FROM orders LEFT JOIN vip ON vip.ID = orders.ID WHERE Level IS NOT NULL`)
+	if err != nil || !reflect.DeepEqual(df.FrameRecords[0].Data, []string{"2", "1"}) {
+		t.Error("Query: counts incorrect", err, df.FrameRecords)
+	}
+
+	// Aggregates match the DataFrame methods.
+	orders := CreateDataFrame(path, "TestData.csv")
+	sd, _ := orders.StandardDeviation("Weight")
+	df, err = q.Query("SELECT MIN(Cost), MAX(Cost), STDDEV(Weight), MAX(Date) FROM orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if df.FrameRecords[0].ConvertToFloat("MIN(Cost)", df.Headers) != orders.Min("Cost") ||
+		df.FrameRecords[0].ConvertToFloat("MAX(Cost)", df.Headers) != orders.Max("Cost") ||
+		df.FrameRecords[0].ConvertToFloat("STDDEV(Weight)", df.Headers) != sd ||
+		df.FrameRecords[0].Val("MAX(Date)", df.Headers) != "2022-01-10" {
+		t.Error("Query: aggregates incorrect", df.FrameRecords)
+	}
+
+	df, err = q.Query("SELECT DISTINCT `Last Name` FROM orders WHERE ID BETWEEN 1 AND 5")
+	if err != nil || df.CountRecords() != 2 {
+		t.Error("Query: distinct incorrect", err, df.FrameRecords)
+	}
+	df, err = q.Query("SELECT * FROM orders JOIN cities ON orders.ID = cities.ID LIMIT 1")
+	if err != nil || !reflect.DeepEqual(df.Columns()[:2], []string{"orders.ID", "Date"}) || df.Columns()[6] != "cities.ID" {
+		t.Error("Query: star columns incorrect", err, df.Columns())
+	}
+
+	// Patterns can come from a column.
+	q.Register("patterns", CreateNewDataFrame([]string{"name", "pattern"}).AddRecord([]string{"Fultz", "f%"}).AddRecord([]string{"Curtis", "%z"}))
+	df, err = q.Query("SELECT name FROM patterns WHERE name LIKE pattern")
+	if err != nil || df.CountRecords() != 1 || df.FrameRecords[0].Data[0] != "Fultz" {
+		t.Error("Query: LIKE with a column pattern incorrect", err, df.FrameRecords)
+	}
+
+	// Empty values do not turn a numeric column into text when ordering.
+	q.Register("gaps", CreateNewDataFrame([]string{"n"}).AddRecord([]string{"10"}).AddRecord([]string{""}).AddRecord([]string{"9"}))
+	df, err = q.Query("SELECT n FROM gaps ORDER BY n DESC")
+	if err != nil || df.FrameRecords[0].Data[0] != "10" || df.FrameRecords[1].Data[0] != "9" || df.FrameRecords[2].Data[0] != "" {
+		t.Error("Query: order with empty values incorrect", err, df.FrameRecords)
+	}
+	df, err = q.Query("SELECT MIN(n), MAX(n), MIN(name) FROM gaps JOIN patterns ON 1 = 1")
+	if err != nil || !reflect.DeepEqual(df.FrameRecords[0].Data, []string{"9", "10", "Curtis"}) {
+		t.Error("Query: MIN and MAX incorrect", err, df.FrameRecords)
+	}
+
+	// Text such as NaN and Inf is not a number.
+	q.Register("names", CreateNewDataFrame([]string{"name"}).AddRecord([]string{"Nan"}).AddRecord([]string{"Inf"}).AddRecord([]string{"5"}).AddRecord([]string{"10"}))
+	for query, want := range map[string][]string{
+		"SELECT name FROM names WHERE name = 'Inf'": {"Inf"},
+		"SELECT name FROM names WHERE name = 5":     {"5"},
+		"SELECT name FROM names ORDER BY name":      {"10", "5", "Inf", "Nan"},
+		"SELECT COUNT(DISTINCT name) FROM names":    {"4"},
+	} {
+		df, err := q.Query(query)
+		var got []string
+		for _, row := range df.FrameRecords {
+			got = append(got, row.Data[0])
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Error("Query: NaN and Inf should be text", query, got, err)
+		}
+	}
+
+	// Empty values are NULL, so comparisons with them are never true.
+	q.Register("blanks", CreateNewDataFrame([]string{"n"}).AddRecord([]string{"3"}).AddRecord([]string{""}).AddRecord([]string{"7"}))
+	for query, want := range map[string][]string{
+		"SELECT n FROM blanks WHERE n < 5":                    {"3"},
+		"SELECT n FROM blanks WHERE NOT n < 5":                {"7"},
+		"SELECT n FROM blanks WHERE n != 3":                   {"7"},
+		"SELECT n FROM blanks WHERE n = ''":                   nil,
+		"SELECT n FROM blanks WHERE n BETWEEN 0 AND 10":       {"3", "7"},
+		"SELECT n FROM blanks WHERE n NOT IN (3)":             {"7"},
+		"SELECT n FROM blanks WHERE n < 5 OR n IS NULL":       {"3", ""},
+		"SELECT n FROM blanks WHERE NOT (n < 5 AND n > 10)":   {"3", "7"},
+		"SELECT a.n FROM blanks a JOIN blanks b ON a.n = b.n": {"3", "7"},
+	} {
+		df, err := q.Query(query)
+		var got []string
+		for _, row := range df.FrameRecords {
+			got = append(got, row.Data[0])
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Error("Query: empty values should be NULL", query, got, err)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT Missing FROM orders",
+		"SELECT ID FROM missing",
+		"SELECT ID FROM orders JOIN cities ON orders.ID = cities.ID",
+		"SELECT ID, COUNT(*) FROM orders",
+		"SELECT Cost FROM orders WHERE SUM(Cost) > 1",
+		"SELECT Cost FROM orders ORDER BY 5",
+		"SELECT Cost FROM orders WHERE",
+		"SELECT SUM(City) FROM cities",
+		"SELECT Cost AS A, Weight AS A FROM orders",
+		"DELETE FROM orders",
+	} {
+		if _, err := q.Query(query); err == nil {
+			t.Error("Query: should error", query)
+		}
+	}
+
+	q.Deregister("vip")
+	if _, err := q.Query("SELECT * FROM vip"); err == nil {
+		t.Error("Query: deregistered table still available")
+	}
+}
+
+func TestSyncFrame(t *testing.T) {
+	path := "./"
+	df := CreateDataFrame(path, "TestData.csv")
+	s := NewSyncFrame(df)
+	if err := s.NewField("Notes"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers and writers share the frame; run with -race to check for data races.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				s.Sum("Cost")
+				s.Unique("Last Name")
+				fultz := s.Filtered("Last Name", "Fultz")
+				fultz.FrameRecords[0].Update("Cost", "0", fultz.Headers)
+				if _, err := s.Val(j%10, "Cost"); err != nil {
+					t.Error("Sync Frame: read failed", err)
+				}
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := s.AddRecord([]string{strconv.Itoa(100 + i*50 + j), "2022-02-01", "1", "1", "Test", "Writer", ""}); err != nil {
+					t.Error("Sync Frame: add failed", err)
+				}
+				if err := s.Update(j%10, "Weight", strconv.Itoa(j)); err != nil {
+					t.Error("Sync Frame: update failed", err)
+				}
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := s.Sort("Cost", true); err != nil {
+			t.Error("Sync Frame: sort failed", err)
+		}
+	}()
+	wg.Wait()
+
+	if s.CountRecords() != 410 || s.Sum("Cost") != 6521+400 {
+		t.Error("Sync Frame: rows lost", s.CountRecords(), s.Sum("Cost"))
+	}
+	if len(s.Filtered("Last Name", "Writer").FrameRecords) != 400 {
+		t.Error("Sync Frame: filtered rows incorrect")
+	}
+
+	// The wrapped frame is a copy and snapshots are independent.
+	if df.CountRecords() != 10 || df.FrameRecords[0].Val("Weight", df.Headers) != "227" {
+		t.Error("Sync Frame: original frame changed")
+	}
+	snapshot := s.Snapshot()
+	if err := s.Update(0, "First Name", "Changed"); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.FrameRecords[0].Val("First Name", snapshot.Headers) == "Changed" {
+		t.Error("Sync Frame: snapshot shares data")
+	}
+	if err := s.Write(func(frame *DataFrame) error { return frame.Sort("ID", false) }); err != nil {
+		t.Fatal(err)
+	}
+	s.Read(func(frame DataFrame) {
+		if frame.FrameRecords[0].Val("ID", frame.Headers) != "499" {
+			t.Error("Sync Frame: sort not applied", frame.FrameRecords[0].Data)
+		}
+	})
+
+	if err := s.AddRecord([]string{"1"}); err == nil {
+		t.Error("Sync Frame: short record should error")
+	}
+	if _, err := s.Val(1000, "Cost"); err == nil {
+		t.Error("Sync Frame: out of range row should error")
+	}
+	if err := s.NewField("Notes"); err == nil {
+		t.Error("Sync Frame: duplicate field should error")
+	}
+}
@@ -0,0 +1,204 @@
+package dataframe
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// Splits the DataFrame into n sub-frames of nearly equal size without copying any rows.
+// The sub-frames share their rows with the original frame, so updated values are visible in both.
+// Fewer sub-frames are returned when the frame has fewer than n rows.
+func (frame DataFrame) Split(n int) ([]DataFrame, error) {
+	if n < 1 {
+		return nil, errors.New("split: number of sub-frames must be at least 1")
+	}
+
+	rows := len(frame.FrameRecords)
+	if n > rows {
+		n = rows
+	}
+	if n == 0 {
+		return []DataFrame{frame.view(frame.FrameRecords)}, nil
+	}
+
+	parts := make([]DataFrame, n)
+	for i := range parts {
+		start, end := i*rows/n, (i+1)*rows/n
+		parts[i] = frame.view(frame.FrameRecords[start:end:end])
+	}
+	return parts, nil
+}
+
+// Splits the DataFrame into at most n sub-frames so that all rows sharing a value in fieldName are kept
+// in the same sub-frame. Groups are spread so each sub-frame holds a similar number of rows, and keep
+// their original row order. Values are not copied, as with Split.
+func (frame DataFrame) SplitByKey(fieldName string, n int) ([]DataFrame, error) {
+	if n < 1 {
+		return nil, errors.New("split by key: number of sub-frames must be at least 1")
+	}
+	pos, ok := frame.Headers[fieldName]
+	if !ok {
+		return nil, fmt.Errorf("split by key: column '%s' does not exist", fieldName)
+	}
+
+	// Collect the rows of each group in the order the groups first appear.
+	index := make(map[string]int)
+	var groups [][]Record
+	for _, row := range frame.FrameRecords {
+		g, ok := index[row.Data[pos]]
+		if !ok {
+			g = len(groups)
+			index[row.Data[pos]] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], row)
+	}
+
+	if n > len(groups) {
+		n = len(groups)
+	}
+	if n == 0 {
+		return []DataFrame{frame.view(frame.FrameRecords)}, nil
+	}
+
+	// Give each group to the sub-frame with the fewest rows so far.
+	records := make([][]Record, n)
+	for _, group := range groups {
+		smallest := 0
+		for i := range records {
+			if len(records[i]) < len(records[smallest]) {
+				smallest = i
+			}
+		}
+		records[smallest] = append(records[smallest], group...)
+	}
+
+	parts := make([]DataFrame, n)
+	for i := range parts {
+		parts[i] = frame.view(records[i])
+	}
+	return parts, nil
+}
+
+// Sub-frame holding the given rows. Each sub-frame has its own header map, so adding or renaming
+// columns in one does not affect the others.
+func (frame DataFrame) view(records []Record) DataFrame {
+	headers := make(map[string]int, len(frame.Headers))
+	for k, v := range frame.Headers {
+		headers[k] = v
+	}
+	return DataFrame{FrameRecords: records, Headers: headers}
+}
+
+// Runs fn on n sub-frames at the same time and stacks the returned frames in the original row order.
+// Sub-frames are created with Split, so fn must not change values it does not own. Every returned
+// frame must have the same columns in the same order. An n below 1 uses one worker per CPU.
+func (frame DataFrame) Parallel(n int, fn func(DataFrame) (DataFrame, error)) (DataFrame, error) {
+	parts, err := frame.Split(workerCount(n))
+	if err != nil {
+		return DataFrame{}, err
+	}
+	return parallelFrames(parts, fn)
+}
+
+// Runs fn on sub-frames created with SplitByKey, so every row sharing a value in fieldName is seen by
+// the same call. The returned frames are stacked in sub-frame order.
+func (frame DataFrame) ParallelByKey(fieldName string, n int, fn func(DataFrame) (DataFrame, error)) (DataFrame, error) {
+	parts, err := frame.SplitByKey(fieldName, workerCount(n))
+	if err != nil {
+		return DataFrame{}, err
+	}
+	return parallelFrames(parts, fn)
+}
+
+// Runs fn on n sub-frames at the same time and folds the results with combine in the original row order,
+// e.g. to total a column. An n below 1 uses one worker per CPU.
+func ParallelReduce[T any](frame DataFrame, n int, fn func(DataFrame) (T, error), combine func(a, b T) T) (T, error) {
+	parts, err := frame.Split(workerCount(n))
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return reduceParts(parts, fn, combine)
+}
+
+// Same as ParallelReduce, with the sub-frames created by SplitByKey.
+func ParallelReduceByKey[T any](frame DataFrame, fieldName string, n int, fn func(DataFrame) (T, error), combine func(a, b T) T) (T, error) {
+	parts, err := frame.SplitByKey(fieldName, workerCount(n))
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return reduceParts(parts, fn, combine)
+}
+
+func workerCount(n int) int {
+	if n < 1 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return n
+}
+
+func parallelFrames(parts []DataFrame, fn func(DataFrame) (DataFrame, error)) (DataFrame, error) {
+	results, err := runParts(parts, fn)
+	if err != nil {
+		return DataFrame{}, err
+	}
+
+	columns := results[0].Columns()
+	rows := 0
+	for i, result := range results {
+		if !slices.Equal(result.Columns(), columns) {
+			return DataFrame{}, fmt.Errorf("parallel: part %d returned columns %v but part 1 returned %v", i+1, result.Columns(), columns)
+		}
+		rows += len(result.FrameRecords)
+	}
+
+	combined := CreateNewDataFrame(columns)
+	combined.FrameRecords = make([]Record, 0, rows)
+	for _, result := range results {
+		combined.FrameRecords = append(combined.FrameRecords, result.FrameRecords...)
+	}
+	return combined, nil
+}
+
+func reduceParts[T any](parts []DataFrame, fn func(DataFrame) (T, error), combine func(a, b T) T) (T, error) {
+	results, err := runParts(parts, fn)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	total := results[0]
+	for _, result := range results[1:] {
+		total = combine(total, result)
+	}
+	return total, nil
+}
+
+// Runs fn on every part in its own goroutine. The error of the first failed part is returned.
+func runParts[T any](parts []DataFrame, fn func(DataFrame) (T, error)) ([]T, error) {
+	results := make([]T, len(parts))
+	errs := make([]error, len(parts))
+
+	var wg sync.WaitGroup
+	for i := range parts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = fn(parts[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("parallel: part %d: %w", i+1, err)
+		}
+	}
+	return results, nil
+}
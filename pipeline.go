@@ -0,0 +1,569 @@
+package dataframe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Settings shared by every stage of a Pipeline.
+type PipelineOptions struct {
+	// Number of goroutines running each Filter, Map, WithColumn, Select and Rename stage. Defaults to 1.
+	Workers int
+	// Keeps rows in input order when Workers is above 1, so Dedupe and the sinks see rows in the order
+	// they were read. Without it rows may be reordered.
+	Ordered bool
+	// Capacity of the channels between stages. Defaults to 64.
+	BufferSize int
+}
+
+// Produces the rows of a Pipeline. It must stop sending and return once ctx is done.
+type PipelineSource func(ctx context.Context, out chan<- StreamingRecord) error
+
+// Chain of stages applied to streamed rows. Stages are added with the chainable methods and nothing
+// runs until one of the sinks (ForEach, Collect, Batch, WriteCSV, BulkUpload, Aggregate) is called.
+// The first error from the source, a stage or the sink stops the whole pipeline and is returned.
+type Pipeline struct {
+	source PipelineSource
+	opts   PipelineOptions
+	stages []pipelineStage
+}
+
+type pipelineStage struct {
+	// Stages keeping state between rows always run on a single goroutine.
+	sequential bool
+	// Returns the transformed row and whether it is kept.
+	apply func(row StreamingRecord) (StreamingRecord, bool, error)
+	// Clears the state of sequential stages before every run.
+	reset func()
+}
+
+// A row moving through the pipeline. Rows that were left out keep flowing as placeholders
+// when order is kept so the rows after them are not held back.
+type pipelineItem struct {
+	seq  int64
+	row  StreamingRecord
+	keep bool
+}
+
+// Creates a pipeline reading rows from a custom source.
+func NewPipeline(source PipelineSource, opts PipelineOptions) *Pipeline {
+	return &Pipeline{source: source, opts: opts}
+}
+
+// Creates a pipeline reading the rows of a csv file. The file is opened each time a sink runs.
+func PipelineFromFile(path, fileName string, load LoadOptions, opts PipelineOptions) *Pipeline {
+	return NewPipeline(func(ctx context.Context, out chan<- StreamingRecord) error {
+		return streamContext(ctx, path, fileName, load, out)
+	}, opts)
+}
+
+// Creates a pipeline reading the rows of a DataFrame.
+func PipelineFromFrame(frame DataFrame, opts PipelineOptions) *Pipeline {
+	return NewPipeline(func(ctx context.Context, out chan<- StreamingRecord) error {
+		for _, row := range frame.FrameRecords {
+			select {
+			case out <- StreamingRecord{Data: row.Data, Headers: frame.Headers}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}, opts)
+}
+
+// Keeps only the rows for which keep returns true.
+func (p *Pipeline) Filter(keep func(row StreamingRecord) bool) *Pipeline {
+	p.stages = append(p.stages, pipelineStage{apply: func(row StreamingRecord) (StreamingRecord, bool, error) {
+		return row, keep(row), nil
+	}})
+	return p
+}
+
+// Replaces every row with the row returned by fn. Rows passed to fn must not be modified in place
+// as they can share memory with the source; build a new Data slice instead.
+func (p *Pipeline) Map(fn func(row StreamingRecord) (StreamingRecord, error)) *Pipeline {
+	p.stages = append(p.stages, pipelineStage{apply: func(row StreamingRecord) (StreamingRecord, bool, error) {
+		row, err := fn(row)
+		return row, err == nil, err
+	}})
+	return p
+}
+
+// Sets a column to the value computed by fn. The column is added at the end when it does not exist yet.
+func (p *Pipeline) WithColumn(name string, fn func(row StreamingRecord) string) *Pipeline {
+	type added struct {
+		headers map[string]int
+		pos     int
+	}
+	cache := headerCache[added]{derive: func(in map[string]int) (added, error) {
+		if pos, ok := in[name]; ok {
+			return added{headers: in, pos: pos}, nil
+		}
+		out := make(map[string]int, len(in)+1)
+		for k, v := range in {
+			out[k] = v
+		}
+		out[name] = len(in)
+		return added{headers: out, pos: len(in)}, nil
+	}}
+
+	p.stages = append(p.stages, pipelineStage{apply: func(row StreamingRecord) (StreamingRecord, bool, error) {
+		a, _ := cache.get(row.Headers)
+		data := make([]string, len(a.headers))
+		copy(data, row.Data)
+		data[a.pos] = fn(row)
+		return StreamingRecord{Data: data, Headers: a.headers}, true, nil
+	}})
+	return p
+}
+
+// Keeps only the provided columns, in the given order.
+func (p *Pipeline) Select(columns ...string) *Pipeline {
+	type selection struct {
+		headers   map[string]int
+		positions []int
+	}
+	cache := headerCache[selection]{derive: func(in map[string]int) (selection, error) {
+		s := selection{headers: make(map[string]int, len(columns))}
+		for i, col := range columns {
+			pos, ok := in[col]
+			if !ok {
+				return s, fmt.Errorf("pipeline select: column '%s' does not exist", col)
+			}
+			s.headers[col] = i
+			s.positions = append(s.positions, pos)
+		}
+		return s, nil
+	}}
+
+	p.stages = append(p.stages, pipelineStage{apply: func(row StreamingRecord) (StreamingRecord, bool, error) {
+		s, err := cache.get(row.Headers)
+		if err != nil {
+			return row, false, err
+		}
+		data := make([]string, len(s.positions))
+		for i, pos := range s.positions {
+			data[i] = row.Data[pos]
+		}
+		return StreamingRecord{Data: data, Headers: s.headers}, true, nil
+	}})
+	return p
+}
+
+// Renames a column.
+func (p *Pipeline) Rename(from, to string) *Pipeline {
+	cache := headerCache[map[string]int]{derive: func(in map[string]int) (map[string]int, error) {
+		pos, ok := in[from]
+		if !ok {
+			return nil, fmt.Errorf("pipeline rename: column '%s' does not exist", from)
+		}
+		if _, ok := in[to]; ok && from != to {
+			return nil, fmt.Errorf("pipeline rename: column '%s' already exists", to)
+		}
+		out := make(map[string]int, len(in))
+		for k, v := range in {
+			out[k] = v
+		}
+		delete(out, from)
+		out[to] = pos
+		return out, nil
+	}}
+
+	p.stages = append(p.stages, pipelineStage{apply: func(row StreamingRecord) (StreamingRecord, bool, error) {
+		headers, err := cache.get(row.Headers)
+		if err != nil {
+			return row, false, err
+		}
+		return StreamingRecord{Data: row.Data, Headers: headers}, true, nil
+	}})
+	return p
+}
+
+// Keeps only the first row for every distinct combination of the key columns. Every key seen is held
+// in memory. Always runs on a single goroutine; set Ordered to keep the first row in input order.
+func (p *Pipeline) Dedupe(keyColumns ...string) *Pipeline {
+	var seen map[string]struct{}
+	var sb strings.Builder
+	reset := func() { seen = make(map[string]struct{}) }
+
+	p.stages = append(p.stages, pipelineStage{sequential: true, reset: reset, apply: func(row StreamingRecord) (StreamingRecord, bool, error) {
+		sb.Reset()
+		for _, col := range keyColumns {
+			pos, ok := row.Headers[col]
+			if !ok {
+				return row, false, fmt.Errorf("pipeline dedupe: column '%s' does not exist", col)
+			}
+			sb.WriteString(row.Data[pos])
+			sb.WriteByte(0)
+		}
+
+		key := sb.String()
+		if _, ok := seen[key]; ok {
+			return row, false, nil
+		}
+		seen[key] = struct{}{}
+		return row, true, nil
+	}})
+	return p
+}
+
+// Calls fn with every row leaving the pipeline, one row at a time and in order when Ordered is set.
+func (p *Pipeline) ForEach(ctx context.Context, fn func(row StreamingRecord) error) error {
+	return p.run(ctx, fn)
+}
+
+// Gathers every row leaving the pipeline into a DataFrame using the header map of the first row.
+func (p *Pipeline) Collect(ctx context.Context) (DataFrame, error) {
+	frame := DataFrame{FrameRecords: []Record{}, Headers: map[string]int{}}
+
+	err := p.run(ctx, func(row StreamingRecord) error {
+		if len(frame.FrameRecords) == 0 {
+			frame.Headers = row.Headers
+		}
+		frame.FrameRecords = append(frame.FrameRecords, Record{Data: row.Data})
+		return nil
+	})
+	if err != nil {
+		return DataFrame{}, err
+	}
+	return frame, nil
+}
+
+// Calls fn with DataFrames of up to size rows. Every row in a batch shares the header map of its first row.
+func (p *Pipeline) Batch(ctx context.Context, size int, fn func(batch DataFrame) error) error {
+	if size <= 0 {
+		return errors.New("pipeline batch: size must be at least one row")
+	}
+
+	batch := DataFrame{FrameRecords: make([]Record, 0, size)}
+	err := p.run(ctx, func(row StreamingRecord) error {
+		if len(batch.FrameRecords) == 0 {
+			batch.Headers = row.Headers
+		}
+		batch.FrameRecords = append(batch.FrameRecords, Record{Data: row.Data})
+		if len(batch.FrameRecords) < size {
+			return nil
+		}
+
+		full := batch
+		batch = DataFrame{FrameRecords: make([]Record, 0, size)}
+		return fn(full)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(batch.FrameRecords) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// Writes every row leaving the pipeline to a csv file with a StreamWriter. The header comes from the first row.
+// Storage, compression and the byte order mark follow opts.
+func (p *Pipeline) WriteCSV(ctx context.Context, path, fileName string, opts SaveOptions) error {
+	w, err := NewStreamWriter(path, fileName, nil, StreamWriterOptions{SaveOptions: opts})
+	if err != nil {
+		return err
+	}
+
+	err = p.run(ctx, w.Write)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Uploads the rows leaving the pipeline in batches of opts.RowsPerBatch using BulkUpload.
+// The table is created or checked before the first batch only. With opts.Transaction every batch
+// runs in its own transaction. With opts.ContinueOnError failed batches are reported and skipped.
+func (p *Pipeline) BulkUpload(ctx context.Context, db *sql.DB, table string, opts BulkUploadOptions) (BulkUploadReport, error) {
+	var report BulkUploadReport
+	var batchErrs []error
+
+	if opts.RowsPerBatch < 1 {
+		opts.RowsPerBatch = 1000
+	}
+	progress := progressOrSilent(opts.Progress)
+	progress.Start("uploading to "+table, -1, ProgressRows)
+
+	err := p.Batch(ctx, opts.RowsPerBatch, func(batch DataFrame) error {
+		batchReport, err := batch.bulkUpload(ctx, db, table, opts, SilentProgress{})
+		opts.CreateTable, opts.CheckTable = false, false
+
+		report.RowsInserted += batchReport.RowsInserted
+		report.RowsFailed += batchReport.RowsFailed
+		report.Batches += batchReport.Batches
+		progress.Add(int64(len(batch.FrameRecords)))
+
+		if err != nil && opts.ContinueOnError && !opts.Transaction && ctx.Err() == nil {
+			batchErrs = append(batchErrs, err)
+			return nil
+		}
+		return err
+	})
+	if err == nil && len(batchErrs) > 0 {
+		err = errors.Join(batchErrs...)
+	}
+	return report, finishProgress(progress, err)
+}
+
+// Receives every row leaving a pipeline, for example to compute totals.
+type Aggregator interface {
+	Add(row StreamingRecord) error
+}
+
+// Passes every row leaving the pipeline to agg.
+func (p *Pipeline) Aggregate(ctx context.Context, agg Aggregator) error {
+	return p.run(ctx, agg.Add)
+}
+
+func (p *Pipeline) workers() int {
+	if p.opts.Workers < 1 {
+		return 1
+	}
+	return p.opts.Workers
+}
+
+func (p *Pipeline) bufferSize() int {
+	if p.opts.BufferSize < 1 {
+		return 64
+	}
+	return p.opts.BufferSize
+}
+
+// Combines consecutive stages that can run in parallel so each row is handed between goroutines once per group.
+func (p *Pipeline) groups() []pipelineStage {
+	var groups []pipelineStage
+	var parallel []pipelineStage
+
+	flush := func() {
+		if len(parallel) == 0 {
+			return
+		}
+		groups = append(groups, pipelineStage{apply: chainStages(parallel)})
+		parallel = nil
+	}
+
+	for _, s := range p.stages {
+		if s.sequential {
+			flush()
+			groups = append(groups, s)
+			continue
+		}
+		parallel = append(parallel, s)
+	}
+	flush()
+	return groups
+}
+
+func chainStages(stages []pipelineStage) func(row StreamingRecord) (StreamingRecord, bool, error) {
+	return func(row StreamingRecord) (StreamingRecord, bool, error) {
+		for _, s := range stages {
+			var keep bool
+			var err error
+			row, keep, err = s.apply(row)
+			if err != nil || !keep {
+				return row, false, err
+			}
+		}
+		return row, true, nil
+	}
+}
+
+// Runs the source and every stage on their own goroutines and passes the surviving rows to sink.
+// After an error every goroutine keeps draining its input without doing work so none of them block.
+func (p *Pipeline) run(ctx context.Context, sink func(row StreamingRecord) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p.source == nil {
+		return errors.New("pipeline: no source provided")
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for _, s := range p.stages {
+		if s.reset != nil {
+			s.reset()
+		}
+	}
+
+	buffer := p.bufferSize()
+	ordered := p.opts.Ordered && p.workers() > 1
+
+	rows := make(chan StreamingRecord, buffer)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(rows)
+		if err := p.source(ctx, rows); err != nil {
+			fail(err)
+		}
+	}()
+
+	items := make(chan pipelineItem, buffer)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(items)
+		var seq int64
+		for row := range rows {
+			if ctx.Err() != nil {
+				continue
+			}
+			select {
+			case items <- pipelineItem{seq: seq, row: row, keep: true}:
+				seq++
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	var in <-chan pipelineItem = items
+	for _, group := range p.groups() {
+		workers := p.workers()
+		if group.sequential {
+			workers = 1
+		}
+
+		out := make(chan pipelineItem, buffer)
+		var groupWG sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			groupWG.Add(1)
+			wg.Add(1)
+			go func(in <-chan pipelineItem, apply func(StreamingRecord) (StreamingRecord, bool, error)) {
+				defer wg.Done()
+				defer groupWG.Done()
+				for item := range in {
+					if ctx.Err() != nil {
+						continue
+					}
+					if item.keep {
+						row, keep, err := apply(item.row)
+						if err != nil {
+							fail(err)
+							continue
+						}
+						item.row, item.keep = row, keep
+					}
+					if !item.keep && !ordered {
+						continue
+					}
+					select {
+					case out <- item:
+					case <-ctx.Done():
+					}
+				}
+			}(in, group.apply)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			groupWG.Wait()
+			close(out)
+		}()
+
+		in = out
+		if ordered && workers > 1 {
+			in = reorderItems(ctx, in, buffer, &wg)
+		}
+	}
+
+	for item := range in {
+		if !item.keep || ctx.Err() != nil {
+			continue
+		}
+		if err := sink(item.row); err != nil {
+			fail(err)
+		}
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return parent.Err()
+}
+
+// Restores the input order of rows that were processed by several workers.
+func reorderItems(ctx context.Context, in <-chan pipelineItem, buffer int, wg *sync.WaitGroup) <-chan pipelineItem {
+	out := make(chan pipelineItem, buffer)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+
+		pending := make(map[int64]pipelineItem)
+		var next int64
+		for item := range in {
+			pending[item.seq] = item
+			for {
+				ready, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+
+				if ctx.Err() != nil {
+					continue
+				}
+				select {
+				case out <- ready:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Builds a value from the header map of the rows entering a stage. Rows usually share one
+// header map, so the value is cached for the last map seen.
+type headerCache[T any] struct {
+	derive func(headers map[string]int) (T, error)
+
+	mu    sync.Mutex
+	ready bool
+	in    map[string]int
+	value T
+	err   error
+}
+
+func (c *headerCache[T]) get(headers map[string]int) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.ready || !sameMap(c.in, headers) {
+		c.value, c.err = c.derive(headers)
+		c.in, c.ready = headers, true
+	}
+	return c.value, c.err
+}
+
+// Reports whether both maps are the same map rather than equal copies.
+func sameMap(a, b map[string]int) bool {
+	return reflect.ValueOf(a).UnsafePointer() == reflect.ValueOf(b).UnsafePointer()
+}
@@ -0,0 +1,266 @@
+package dataframe
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	progressbar "github.com/schollz/progressbar/v3"
+)
+
+// Unit of the work tracked by a ProgressReporter.
+type ProgressUnit int
+
+const (
+	ProgressRows ProgressUnit = iota
+	ProgressBytes
+	ProgressFiles
+)
+
+func (u ProgressUnit) String() string {
+	switch u {
+	case ProgressBytes:
+		return "bytes"
+	case ProgressFiles:
+		return "files"
+	default:
+		return "rows"
+	}
+}
+
+// Receives updates from long running operations such as loading, saving, uploading and S3 transfers.
+// Add may be called from several goroutines while a single operation runs.
+type ProgressReporter interface {
+	// Called once before work begins. Total is -1 when the amount of work is not known upfront.
+	Start(operation string, total int64, unit ProgressUnit)
+	// Called whenever n more units of work are done.
+	Add(n int64)
+	// Called once when the operation completes successfully.
+	Finish()
+	// Called once instead of Finish when the operation fails.
+	Error(err error)
+}
+
+// Returns a reporter that ignores every update when none is provided.
+func progressOrSilent(p ProgressReporter) ProgressReporter {
+	if p == nil {
+		return SilentProgress{}
+	}
+	return p
+}
+
+// Reports the outcome of an operation to the reporter and passes the error through.
+func finishProgress(p ProgressReporter, err error) error {
+	if err != nil {
+		p.Error(err)
+		return err
+	}
+	p.Finish()
+	return nil
+}
+
+// Discards all progress updates.
+type SilentProgress struct{}
+
+func (SilentProgress) Start(string, int64, ProgressUnit) {}
+func (SilentProgress) Add(int64)                         {}
+func (SilentProgress) Finish()                           {}
+func (SilentProgress) Error(error)                       {}
+
+// Draws a progress bar in the terminal.
+type TerminalProgress struct {
+	// Destination of the bar. Defaults to os.Stderr.
+	Writer io.Writer
+
+	mu  sync.Mutex
+	bar *progressbar.ProgressBar
+}
+
+// Creates a terminal progress bar that is drawn to w, or os.Stderr when w is nil.
+func NewTerminalProgress(w io.Writer) *TerminalProgress {
+	return &TerminalProgress{Writer: w}
+}
+
+func (p *TerminalProgress) writer() io.Writer {
+	if p.Writer == nil {
+		return os.Stderr
+	}
+	return p.Writer
+}
+
+func (p *TerminalProgress) Start(operation string, total int64, unit ProgressUnit) {
+	w := p.writer()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bar = progressbar.NewOptions64(
+		total,
+		progressbar.OptionSetDescription(operation),
+		progressbar.OptionSetWriter(w),
+		progressbar.OptionShowBytes(unit == ProgressBytes),
+		progressbar.OptionShowTotalBytes(true),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(w, "\n")
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+}
+
+func (p *TerminalProgress) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bar != nil {
+		p.bar.Add64(n)
+	}
+}
+
+func (p *TerminalProgress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bar != nil {
+		p.bar.Finish()
+	}
+}
+
+func (p *TerminalProgress) Error(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bar != nil {
+		p.bar.Exit()
+		fmt.Fprintln(p.writer(), "\nerror:", err)
+	}
+}
+
+// Forwards progress updates to user provided functions. Nil functions are skipped.
+type CallbackProgress struct {
+	OnStart  func(operation string, total int64, unit ProgressUnit)
+	OnAdd    func(n int64)
+	OnFinish func()
+	OnError  func(err error)
+}
+
+func (p CallbackProgress) Start(operation string, total int64, unit ProgressUnit) {
+	if p.OnStart != nil {
+		p.OnStart(operation, total, unit)
+	}
+}
+
+func (p CallbackProgress) Add(n int64) {
+	if p.OnAdd != nil {
+		p.OnAdd(n)
+	}
+}
+
+func (p CallbackProgress) Finish() {
+	if p.OnFinish != nil {
+		p.OnFinish()
+	}
+}
+
+func (p CallbackProgress) Error(err error) {
+	if p.OnError != nil {
+		p.OnError(err)
+	}
+}
+
+// Writes progress as structured log entries, which suits JSON logs better than a terminal bar.
+type SlogProgress struct {
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu        sync.Mutex
+	operation string
+	unit      ProgressUnit
+	total     int64
+	done      int64
+	started   time.Time
+	lastLog   time.Time
+}
+
+// Creates a reporter that logs to logger, or slog.Default() when logger is nil.
+// Intermediate progress is logged at most once per interval. A zero interval only logs start and end.
+func NewSlogProgress(logger *slog.Logger, interval time.Duration) *SlogProgress {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogProgress{logger: logger, interval: interval}
+}
+
+func (p *SlogProgress) Start(operation string, total int64, unit ProgressUnit) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.operation, p.total, p.unit, p.done = operation, total, unit, 0
+	p.started = time.Now()
+	p.lastLog = p.started
+	p.logger.Info("progress started", "operation", operation, "total", total, "unit", unit.String())
+}
+
+func (p *SlogProgress) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done += n
+	if p.interval <= 0 || time.Since(p.lastLog) < p.interval {
+		return
+	}
+	p.lastLog = time.Now()
+	p.logger.Info("progress", "operation", p.operation, "done", p.done, "total", p.total, "unit", p.unit.String())
+}
+
+func (p *SlogProgress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.logger.Info("progress finished", "operation", p.operation, "done", p.done, "unit", p.unit.String(),
+		"duration", time.Since(p.started))
+}
+
+func (p *SlogProgress) Error(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.logger.Error("progress failed", "operation", p.operation, "done", p.done, "unit", p.unit.String(),
+		"error", err)
+}
+
+// Counts the bytes read through it.
+type progressReader struct {
+	r        io.Reader
+	progress ProgressReporter
+}
+
+func (r progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.progress.Add(int64(n))
+	}
+	return n, err
+}
+
+// Counts the bytes written through it.
+type progressWriterAt struct {
+	w        io.WriterAt
+	progress ProgressReporter
+}
+
+func (w progressWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.w.WriteAt(p, off)
+	if n > 0 {
+		w.progress.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,992 @@
+package dataframe
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// Named DataFrames that can be queried with SQL SELECT statements. Safe for concurrent use.
+type QueryContext struct {
+	mu     sync.RWMutex
+	tables map[string]DataFrame
+}
+
+func NewQueryContext() *QueryContext {
+	return &QueryContext{tables: make(map[string]DataFrame)}
+}
+
+// Makes the DataFrame available to queries under name, replacing any frame registered with that name.
+// Queries read the frame's rows directly, so do not change it while queries are running.
+func (q *QueryContext) Register(name string, frame DataFrame) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.tables[name] = frame
+}
+
+func (q *QueryContext) Deregister(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.tables, name)
+}
+
+// Names of the registered tables in lexicographic order.
+func (q *QueryContext) Tables() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	names := make([]string, 0, len(q.tables))
+	for name := range q.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Runs a SELECT statement and returns the result as a new DataFrame.
+//
+// Supported are DISTINCT, inner and left joins, WHERE, GROUP BY, HAVING, ORDER BY, LIMIT and OFFSET,
+// the aggregate functions SUM, AVG, MIN, MAX, COUNT and STDDEV, comparisons, arithmetic, AND, OR,
+// NOT, IN, BETWEEN, LIKE and IS NULL. Values that look like numbers are compared as numbers and all
+// other values as text. Empty values are treated as NULL: comparisons with them are never true, IS NULL
+// matches them and the aggregate functions skip them. STDDEV is the population standard deviation, as
+// with StandardDeviation. Column names containing spaces are written in double quotes, backticks or
+// square brackets.
+//
+// Queries follow SQL rather than the DataFrame methods where the two differ. Joins return every
+// matching row, where Merge and InnerMerge use the first match. ORDER BY, MIN and MAX order a column as
+// numbers when every value that is not empty is a number, where Sort switches to text order for a single
+// empty value; empty values sort first and text columns are ordered as text, where Min and Max stop the
+// program. ORDER BY keeps the original order of equal rows.
+func (q *QueryContext) Query(query string) (DataFrame, error) {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return DataFrame{}, err
+	}
+
+	q.mu.RLock()
+	tables := make(map[string]DataFrame, len(q.tables))
+	for name, frame := range q.tables {
+		tables[name] = frame
+	}
+	q.mu.RUnlock()
+
+	return runSelect(stmt, tables)
+}
+
+// Columns available to expressions: every column of every table in the FROM and JOIN clauses.
+type sqlScope struct {
+	tables  []string
+	columns []string
+}
+
+func (s *sqlScope) add(alias string, frame DataFrame) error {
+	if slices.Contains(s.tables, alias) {
+		return fmt.Errorf("sql query: table name '%s' is used more than once, use AS to rename it", alias)
+	}
+	for _, col := range frame.Columns() {
+		s.tables = append(s.tables, alias)
+		s.columns = append(s.columns, col)
+	}
+	return nil
+}
+
+func (s *sqlScope) resolve(c *sqlColumn) error {
+	if len(c.table) > 0 && !slices.Contains(s.tables, c.table) {
+		return fmt.Errorf("sql query: unknown table '%s'", c.table)
+	}
+
+	c.pos = -1
+	for i, name := range s.columns {
+		if name != c.name || (len(c.table) > 0 && s.tables[i] != c.table) {
+			continue
+		}
+		if c.pos >= 0 {
+			return fmt.Errorf("sql query: column '%s' is ambiguous, use table.column", c.name)
+		}
+		c.pos = i
+	}
+	if c.pos < 0 {
+		return fmt.Errorf("sql query: unknown column '%s'", c)
+	}
+	return nil
+}
+
+// Resolves every column in the expression and compiles literal LIKE patterns. Aggregates are only
+// allowed when clause is empty.
+func (s *sqlScope) resolveExpr(e sqlExpr, clause string) error {
+	return walkSQL(e, func(e sqlExpr, inAggregate bool) error {
+		switch e := e.(type) {
+		case *sqlColumn:
+			return s.resolve(e)
+		case *sqlLike:
+			if lit, ok := e.pattern.(*sqlLiteral); ok && e.re == nil {
+				e.re = likeRegexp(lit.value)
+			}
+		case *sqlAggregate:
+			if len(clause) > 0 {
+				return fmt.Errorf("sql query: aggregate functions are not allowed in %s", clause)
+			}
+			if inAggregate {
+				return fmt.Errorf("sql query: aggregate functions cannot be nested in %s", e)
+			}
+		}
+		return nil
+	})
+}
+
+// Calls fn for the expression and everything it contains, reporting whether e is inside an aggregate.
+func walkSQL(e sqlExpr, fn func(e sqlExpr, inAggregate bool) error) error {
+	var walk func(e sqlExpr, inAggregate bool) error
+	walk = func(e sqlExpr, inAggregate bool) error {
+		if e == nil {
+			return nil
+		}
+		if err := fn(e, inAggregate); err != nil {
+			return err
+		}
+		if agg, ok := e.(*sqlAggregate); ok {
+			return walk(agg.arg, true)
+		}
+		for _, child := range sqlChildren(e) {
+			if err := walk(child, inAggregate); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(e, false)
+}
+
+func sqlChildren(e sqlExpr) []sqlExpr {
+	switch e := e.(type) {
+	case *sqlUnary:
+		return []sqlExpr{e.expr}
+	case *sqlBinary:
+		return []sqlExpr{e.left, e.right}
+	case *sqlIn:
+		return append([]sqlExpr{e.expr}, e.list...)
+	case *sqlBetween:
+		return []sqlExpr{e.expr, e.low, e.high}
+	case *sqlLike:
+		return []sqlExpr{e.expr, e.pattern}
+	case *sqlIsNull:
+		return []sqlExpr{e.expr}
+	case *sqlAggregate:
+		if e.arg != nil {
+			return []sqlExpr{e.arg}
+		}
+	}
+	return nil
+}
+
+func hasAggregate(e sqlExpr) bool {
+	found := false
+	walkSQL(e, func(e sqlExpr, _ bool) error {
+		if _, ok := e.(*sqlAggregate); ok {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// A row of the result together with the values it is sorted by.
+type sqlResultRow struct {
+	values []string
+	keys   []string
+}
+
+func runSelect(stmt *sqlSelect, tables map[string]DataFrame) (DataFrame, error) {
+	table := func(ref sqlTableRef) (DataFrame, error) {
+		frame, ok := tables[ref.name]
+		if !ok {
+			return DataFrame{}, fmt.Errorf("sql query: unknown table '%s'", ref.name)
+		}
+		return frame, nil
+	}
+
+	frame, err := table(stmt.from)
+	if err != nil {
+		return DataFrame{}, err
+	}
+	scope := &sqlScope{}
+	if err := scope.add(stmt.from.alias, frame); err != nil {
+		return DataFrame{}, err
+	}
+	rows := make([][]string, len(frame.FrameRecords))
+	for i, row := range frame.FrameRecords {
+		rows[i] = row.Data
+	}
+
+	for _, join := range stmt.joins {
+		right, err := table(join.table)
+		if err != nil {
+			return DataFrame{}, err
+		}
+		width := len(scope.columns)
+		if err := scope.add(join.table.alias, right); err != nil {
+			return DataFrame{}, err
+		}
+		if err := scope.resolveExpr(join.on, "ON"); err != nil {
+			return DataFrame{}, err
+		}
+		if rows, err = joinRows(rows, right, width, join); err != nil {
+			return DataFrame{}, err
+		}
+	}
+
+	if stmt.where != nil {
+		if err := scope.resolveExpr(stmt.where, "WHERE"); err != nil {
+			return DataFrame{}, err
+		}
+		kept := rows[:0:0]
+		for _, row := range rows {
+			ok, err := evalSQL(stmt.where, row, nil)
+			if err != nil {
+				return DataFrame{}, err
+			}
+			if ok == sqlTrue {
+				kept = append(kept, row)
+			}
+		}
+		rows = kept
+	}
+
+	items, names, err := selectItems(stmt.items, scope)
+	if err != nil {
+		return DataFrame{}, err
+	}
+
+	for _, expr := range stmt.groupBy {
+		if err := scope.resolveExpr(expr, "GROUP BY"); err != nil {
+			return DataFrame{}, err
+		}
+	}
+	if stmt.having != nil {
+		if err := scope.resolveExpr(stmt.having, ""); err != nil {
+			return DataFrame{}, err
+		}
+	}
+
+	// Work out what every ORDER BY item refers to: a result column or an expression of the input.
+	orderColumns := make([]int, len(stmt.orderBy))
+	for i, order := range stmt.orderBy {
+		orderColumns[i] = orderColumn(order.expr, items, names)
+		if orderColumns[i] == -2 {
+			return DataFrame{}, fmt.Errorf("sql query: ORDER BY position %s is out of range", order.expr)
+		}
+		if orderColumns[i] < 0 {
+			if err := scope.resolveExpr(order.expr, ""); err != nil {
+				return DataFrame{}, err
+			}
+		}
+	}
+
+	grouped := len(stmt.groupBy) > 0 || stmt.having != nil
+	for _, item := range items {
+		grouped = grouped || hasAggregate(item)
+	}
+	for i, order := range stmt.orderBy {
+		grouped = grouped || (orderColumns[i] < 0 && hasAggregate(order.expr))
+	}
+
+	// Every row is its own group when nothing is aggregated.
+	var groups [][][]string
+	if grouped {
+		check := append(slices.Clone(items), stmt.having)
+		for i, order := range stmt.orderBy {
+			if orderColumns[i] < 0 {
+				check = append(check, order.expr)
+			}
+		}
+		for _, expr := range check {
+			if err := checkGrouped(expr, stmt.groupBy); err != nil {
+				return DataFrame{}, err
+			}
+		}
+		if groups, err = groupRows(rows, stmt.groupBy); err != nil {
+			return DataFrame{}, err
+		}
+	} else {
+		groups = make([][][]string, len(rows))
+		for i, row := range rows {
+			groups[i] = [][]string{row}
+		}
+	}
+
+	var results []sqlResultRow
+	for _, group := range groups {
+		var first []string
+		if len(group) > 0 {
+			first = group[0]
+		}
+		if stmt.having != nil {
+			ok, err := evalSQL(stmt.having, first, group)
+			if err != nil {
+				return DataFrame{}, err
+			}
+			if ok != sqlTrue {
+				continue
+			}
+		}
+
+		result := sqlResultRow{values: make([]string, len(items)), keys: make([]string, len(stmt.orderBy))}
+		for i, item := range items {
+			if result.values[i], err = evalSQL(item, first, group); err != nil {
+				return DataFrame{}, err
+			}
+		}
+		for i, order := range stmt.orderBy {
+			if orderColumns[i] >= 0 {
+				result.keys[i] = result.values[orderColumns[i]]
+			} else if result.keys[i], err = evalSQL(order.expr, first, group); err != nil {
+				return DataFrame{}, err
+			}
+		}
+		results = append(results, result)
+	}
+
+	if stmt.distinct {
+		seen := make(map[string]bool)
+		unique := results[:0]
+		for _, result := range results {
+			key := strings.Join(result.values, "\x00")
+			if !seen[key] {
+				seen[key] = true
+				unique = append(unique, result)
+			}
+		}
+		results = unique
+	}
+
+	sortResults(results, stmt.orderBy)
+
+	if stmt.offset > 0 {
+		results = results[min(stmt.offset, len(results)):]
+	}
+	if stmt.limit >= 0 && stmt.limit < len(results) {
+		results = results[:stmt.limit]
+	}
+
+	df := CreateNewDataFrame(names)
+	df.FrameRecords = make([]Record, len(results))
+	for i, result := range results {
+		df.FrameRecords[i] = Record{Data: result.values}
+	}
+	return df, nil
+}
+
+// Combines the rows so far with the rows of a joined table. Equality between a column of each side
+// is matched through a lookup table, any other condition is checked for every pair of rows.
+func joinRows(rows [][]string, right DataFrame, width int, join sqlJoin) ([][]string, error) {
+	rightWidth := len(right.Headers)
+	combine := func(left, right []string) []string {
+		row := make([]string, 0, width+rightWidth)
+		row = append(row, left...)
+		if right == nil {
+			return append(row, make([]string, rightWidth)...)
+		}
+		return append(row, right...)
+	}
+
+	var matches func(left []string) ([][]string, error)
+	if l, r, ok := equiJoin(join.on, width); ok {
+		// Empty values never match, so they are left out.
+		lookup := make(map[string][][]string)
+		for _, row := range right.FrameRecords {
+			if value := row.Data[r-width]; len(value) > 0 {
+				lookup[sqlKey(value)] = append(lookup[sqlKey(value)], row.Data)
+			}
+		}
+		matches = func(left []string) ([][]string, error) {
+			if len(left[l]) == 0 {
+				return nil, nil
+			}
+			return lookup[sqlKey(left[l])], nil
+		}
+	} else {
+		matches = func(left []string) ([][]string, error) {
+			var found [][]string
+			for _, row := range right.FrameRecords {
+				ok, err := evalSQL(join.on, combine(left, row.Data), nil)
+				if err != nil {
+					return nil, err
+				}
+				if ok == sqlTrue {
+					found = append(found, row.Data)
+				}
+			}
+			return found, nil
+		}
+	}
+
+	var joined [][]string
+	for _, left := range rows {
+		found, err := matches(left)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range found {
+			joined = append(joined, combine(left, row))
+		}
+		if len(found) == 0 && join.left {
+			joined = append(joined, combine(left, nil))
+		}
+	}
+	return joined, nil
+}
+
+// Positions of the left and right column when the join condition is a single equality between them.
+func equiJoin(on sqlExpr, width int) (int, int, bool) {
+	eq, ok := on.(*sqlBinary)
+	if !ok || eq.op != "=" {
+		return 0, 0, false
+	}
+	a, okA := eq.left.(*sqlColumn)
+	b, okB := eq.right.(*sqlColumn)
+	if !okA || !okB {
+		return 0, 0, false
+	}
+	if a.pos < width && b.pos >= width {
+		return a.pos, b.pos, true
+	}
+	if b.pos < width && a.pos >= width {
+		return b.pos, a.pos, true
+	}
+	return 0, 0, false
+}
+
+// Lookup key under which values that compare as equal are stored.
+func sqlKey(value string) string {
+	if f, ok := parseSQLNumber(value); ok {
+		return formatSQLNumber(f)
+	}
+	return value
+}
+
+// Expands * and resolves the selected expressions. Returns the expressions and the result column names.
+func selectItems(selected []sqlSelectItem, scope *sqlScope) ([]sqlExpr, []string, error) {
+	var items []sqlExpr
+	var names []string
+	var isColumn []bool
+
+	for _, item := range selected {
+		if item.star {
+			if len(item.table) > 0 && !slices.Contains(scope.tables, item.table) {
+				return nil, nil, fmt.Errorf("sql query: unknown table '%s'", item.table)
+			}
+			for i, col := range scope.columns {
+				if len(item.table) == 0 || scope.tables[i] == item.table {
+					items = append(items, &sqlColumn{table: scope.tables[i], name: col, pos: i})
+					names = append(names, col)
+					isColumn = append(isColumn, true)
+				}
+			}
+			continue
+		}
+
+		if err := scope.resolveExpr(item.expr, ""); err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item.expr)
+		col, ok := item.expr.(*sqlColumn)
+		switch {
+		case len(item.alias) > 0:
+			names = append(names, item.alias)
+			ok = false
+		case ok:
+			names = append(names, col.name)
+		default:
+			names = append(names, item.expr.String())
+		}
+		isColumn = append(isColumn, ok)
+	}
+
+	// Columns with the same name from different tables are named table.column.
+	original := slices.Clone(names)
+	for i, name := range original {
+		if isColumn[i] && countString(original, name) > 1 {
+			names[i] = scope.tables[items[i].(*sqlColumn).pos] + "." + name
+		}
+	}
+	for i, name := range names {
+		if slices.Index(names, name) != i {
+			return nil, nil, fmt.Errorf("sql query: column name '%s' is used more than once, use AS to rename it", name)
+		}
+	}
+	return items, names, nil
+}
+
+func countString(values []string, value string) int {
+	count := 0
+	for _, v := range values {
+		if v == value {
+			count++
+		}
+	}
+	return count
+}
+
+// Result column an ORDER BY item refers to: a position such as 2, a result column name or a selected
+// expression. Returns -1 for other expressions and -2 for positions that are out of range.
+func orderColumn(e sqlExpr, items []sqlExpr, names []string) int {
+	if lit, ok := e.(*sqlLiteral); ok && lit.number {
+		n, err := strconv.Atoi(lit.value)
+		if err != nil || n < 1 || n > len(items) {
+			return -2
+		}
+		return n - 1
+	}
+	if col, ok := e.(*sqlColumn); ok && len(col.table) == 0 {
+		if i := slices.Index(names, col.name); i >= 0 {
+			return i
+		}
+	}
+	for i, item := range items {
+		if item.String() == e.String() {
+			return i
+		}
+	}
+	return -1
+}
+
+// Ensures columns outside aggregate functions are grouped, so they have a single value in every group.
+func checkGrouped(e sqlExpr, groupBy []sqlExpr) error {
+	if e == nil {
+		return nil
+	}
+	if _, ok := e.(*sqlAggregate); ok {
+		return nil
+	}
+	for _, group := range groupBy {
+		if group.String() == e.String() {
+			return nil
+		}
+		if a, ok := group.(*sqlColumn); ok {
+			if b, ok := e.(*sqlColumn); ok && a.pos == b.pos {
+				return nil
+			}
+		}
+	}
+	if col, ok := e.(*sqlColumn); ok {
+		return fmt.Errorf("sql query: column '%s' must be in GROUP BY or used in an aggregate function", col)
+	}
+	for _, child := range sqlChildren(e) {
+		if err := checkGrouped(child, groupBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Groups rows by the values of the GROUP BY expressions, in the order the groups first appear.
+// Without GROUP BY every row is in a single group, which exists even when there are no rows.
+func groupRows(rows [][]string, groupBy []sqlExpr) ([][][]string, error) {
+	if len(groupBy) == 0 {
+		return [][][]string{rows}, nil
+	}
+
+	index := make(map[string]int)
+	var groups [][][]string
+	values := make([]string, len(groupBy))
+	for _, row := range rows {
+		for i, expr := range groupBy {
+			value, err := evalSQL(expr, row, nil)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = sqlKey(value)
+		}
+		key := strings.Join(values, "\x00")
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], row)
+	}
+	return groups, nil
+}
+
+// Sorts the results by their keys, keeping the original order of equal rows.
+func sortResults(results []sqlResultRow, orderBy []sqlOrder) {
+	if len(orderBy) == 0 {
+		return
+	}
+
+	numeric := make([]bool, len(orderBy))
+	keys := make([]string, len(results))
+	for k := range orderBy {
+		for i, result := range results {
+			keys[i] = result.keys[k]
+		}
+		numeric[k] = numericSQL(keys)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		for k, order := range orderBy {
+			if c := compareOrdered(results[i].keys[k], results[j].keys[k], numeric[k]); c != 0 {
+				return (c < 0) != order.desc
+			}
+		}
+		return false
+	})
+}
+
+// Reports whether every value that is not empty is a number. Such values are ordered as numbers, as
+// Sort does for numeric columns, and all others as text.
+func numericSQL(values []string) bool {
+	for _, value := range values {
+		if _, ok := parseSQLNumber(value); !ok && len(value) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Orders values as numbers or as text, with empty values first.
+func compareOrdered(a, b string, numeric bool) int {
+	switch {
+	case len(a) == 0 || len(b) == 0:
+		return compareFloats(float64(len(a)), float64(len(b)))
+	case numeric:
+		x, _ := parseSQLNumber(a)
+		y, _ := parseSQLNumber(b)
+		return compareFloats(x, y)
+	}
+	return strings.Compare(a, b)
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// Results of conditions. A condition involving an empty value is neither true nor false but empty,
+// which WHERE, HAVING and ON treat as false.
+const (
+	sqlTrue  = "true"
+	sqlFalse = "false"
+)
+
+func sqlBool(b bool) string {
+	if b {
+		return sqlTrue
+	}
+	return sqlFalse
+}
+
+// Compares values as numbers when both are numbers and as text otherwise.
+func compareSQL(a, b string) int {
+	x, okX := parseSQLNumber(a)
+	y, okY := parseSQLNumber(b)
+	if okX && okY {
+		return compareFloats(x, y)
+	}
+	return strings.Compare(a, b)
+}
+
+// Parses a finite number. Text such as NaN and Inf is not a number, so it is compared as text.
+func parseSQLNumber(value string) (float64, bool) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func formatSQLNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Evaluates an expression for a row. Aggregate functions are evaluated over the rows of group.
+func evalSQL(e sqlExpr, row []string, group [][]string) (string, error) {
+	switch e := e.(type) {
+	case *sqlLiteral:
+		return e.value, nil
+
+	case *sqlColumn:
+		if e.pos >= len(row) {
+			return "", nil
+		}
+		return row[e.pos], nil
+
+	case *sqlUnary:
+		value, err := evalSQL(e.expr, row, group)
+		if err != nil {
+			return "", err
+		}
+		if e.op == "NOT" {
+			if len(value) == 0 {
+				return "", nil
+			}
+			return sqlBool(value != sqlTrue), nil
+		}
+		if len(value) == 0 {
+			return "", nil
+		}
+		f, err := sqlFloat(e, value)
+		if err != nil {
+			return "", err
+		}
+		return formatSQLNumber(-f), nil
+
+	case *sqlBinary:
+		left, err := evalSQL(e.left, row, group)
+		if err != nil {
+			return "", err
+		}
+		switch e.op {
+		case "AND":
+			if len(left) > 0 && left != sqlTrue {
+				return sqlFalse, nil
+			}
+		case "OR":
+			if left == sqlTrue {
+				return sqlTrue, nil
+			}
+		}
+		right, err := evalSQL(e.right, row, group)
+		if err != nil {
+			return "", err
+		}
+		return binarySQL(e, left, right)
+
+	case *sqlIn:
+		value, err := evalSQL(e.expr, row, group)
+		if err != nil || len(value) == 0 {
+			return "", err
+		}
+		empty := false
+		for _, item := range e.list {
+			candidate, err := evalSQL(item, row, group)
+			if err != nil {
+				return "", err
+			}
+			if len(candidate) == 0 {
+				empty = true
+			} else if compareSQL(value, candidate) == 0 {
+				return sqlBool(!e.not), nil
+			}
+		}
+		// Without a match the value might still equal the empty item.
+		if empty {
+			return "", nil
+		}
+		return sqlBool(e.not), nil
+
+	case *sqlBetween:
+		values := make([]string, 3)
+		for i, expr := range []sqlExpr{e.expr, e.low, e.high} {
+			var err error
+			if values[i], err = evalSQL(expr, row, group); err != nil || len(values[i]) == 0 {
+				return "", err
+			}
+		}
+		between := compareSQL(values[0], values[1]) >= 0 && compareSQL(values[0], values[2]) <= 0
+		return sqlBool(between != e.not), nil
+
+	case *sqlLike:
+		value, err := evalSQL(e.expr, row, group)
+		if err != nil {
+			return "", err
+		}
+		pattern, err := evalSQL(e.pattern, row, group)
+		if err != nil || len(value) == 0 || len(pattern) == 0 {
+			return "", err
+		}
+		re := e.re
+		if re == nil {
+			re = likeRegexp(pattern)
+		}
+		return sqlBool(re.MatchString(value) != e.not), nil
+
+	case *sqlIsNull:
+		value, err := evalSQL(e.expr, row, group)
+		if err != nil {
+			return "", err
+		}
+		return sqlBool((len(value) == 0) != e.not), nil
+
+	case *sqlAggregate:
+		return aggregateSQL(e, group)
+	}
+	return "", fmt.Errorf("sql query: cannot evaluate %s", e)
+}
+
+func binarySQL(e *sqlBinary, left, right string) (string, error) {
+	switch e.op {
+	case "AND":
+		// False wins over empty, empty over true.
+		if len(right) > 0 && right != sqlTrue {
+			return sqlFalse, nil
+		}
+		if len(left) == 0 || len(right) == 0 {
+			return "", nil
+		}
+		return sqlTrue, nil
+	case "OR":
+		// True wins over empty, empty over false.
+		if right == sqlTrue {
+			return sqlTrue, nil
+		}
+		if len(left) == 0 || len(right) == 0 {
+			return "", nil
+		}
+		return sqlFalse, nil
+	}
+
+	// Comparisons and arithmetic with an empty value are empty.
+	if len(left) == 0 || len(right) == 0 {
+		return "", nil
+	}
+	switch e.op {
+	case "=":
+		return sqlBool(compareSQL(left, right) == 0), nil
+	case "!=":
+		return sqlBool(compareSQL(left, right) != 0), nil
+	case "<":
+		return sqlBool(compareSQL(left, right) < 0), nil
+	case "<=":
+		return sqlBool(compareSQL(left, right) <= 0), nil
+	case ">":
+		return sqlBool(compareSQL(left, right) > 0), nil
+	case ">=":
+		return sqlBool(compareSQL(left, right) >= 0), nil
+	}
+
+	x, err := sqlFloat(e, left)
+	if err != nil {
+		return "", err
+	}
+	y, err := sqlFloat(e, right)
+	if err != nil {
+		return "", err
+	}
+	switch e.op {
+	case "+":
+		return formatSQLNumber(x + y), nil
+	case "-":
+		return formatSQLNumber(x - y), nil
+	case "*":
+		return formatSQLNumber(x * y), nil
+	case "/":
+		if y == 0 {
+			return "", nil
+		}
+		return formatSQLNumber(x / y), nil
+	case "%":
+		if y == 0 {
+			return "", nil
+		}
+		return formatSQLNumber(math.Mod(x, y)), nil
+	}
+	return "", fmt.Errorf("sql query: unknown operator %s", e.op)
+}
+
+func sqlFloat(e sqlExpr, value string) (float64, error) {
+	f, ok := parseSQLNumber(value)
+	if !ok {
+		return 0, fmt.Errorf("sql query: '%s' in %s is not a number", value, e)
+	}
+	return f, nil
+}
+
+// Regular expression for a LIKE pattern, where % matches any text and _ a single character. Case is ignored.
+func likeRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func aggregateSQL(e *sqlAggregate, group [][]string) (string, error) {
+	if e.arg == nil {
+		return strconv.Itoa(len(group)), nil
+	}
+
+	var values []string
+	seen := make(map[string]bool)
+	for _, row := range group {
+		value, err := evalSQL(e.arg, row, nil)
+		if err != nil {
+			return "", err
+		}
+		if len(value) == 0 {
+			continue
+		}
+		if e.distinct {
+			if seen[sqlKey(value)] {
+				continue
+			}
+			seen[sqlKey(value)] = true
+		}
+		values = append(values, value)
+	}
+
+	if e.name == "COUNT" {
+		return strconv.Itoa(len(values)), nil
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	if e.name == "MIN" || e.name == "MAX" {
+		numeric := numericSQL(values)
+		best := values[0]
+		for _, value := range values[1:] {
+			c := compareOrdered(value, best, numeric)
+			if (e.name == "MIN" && c < 0) || (e.name == "MAX" && c > 0) {
+				best = value
+			}
+		}
+		return best, nil
+	}
+
+	nums := make([]float64, len(values))
+	sum := 0.0
+	for i, value := range values {
+		f, err := sqlFloat(e, value)
+		if err != nil {
+			return "", err
+		}
+		nums[i] = f
+		sum += f
+	}
+
+	switch e.name {
+	case "SUM":
+		return formatSQLNumber(sum), nil
+	case "AVG":
+		return formatSQLNumber(sum / float64(len(nums))), nil
+	case "STDDEV":
+		return formatSQLNumber(standardDeviation(nums)), nil
+	}
+	return "", errors.New("sql query: unknown aggregate function " + e.name)
+}
@@ -0,0 +1,799 @@
+package dataframe
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type sqlTokenKind int
+
+const (
+	sqlEOF sqlTokenKind = iota
+	sqlIdent
+	// Identifier written in double quotes, backticks or square brackets. Never a keyword.
+	sqlQuotedIdent
+	sqlString
+	sqlNumber
+	sqlSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			// Comment until the end of the line.
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			continue
+
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlIdent, text: string(runes[start:i]), pos: start})
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, text: string(runes[start:i]), pos: start})
+
+		case r == '\'' || r == '"' || r == '`' || r == '[':
+			closing := r
+			if r == '[' {
+				closing = ']'
+			}
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("sql query: unterminated %c at position %d", r, start+1)
+				}
+				if runes[i] == closing {
+					// A doubled closing quote stands for the quote itself.
+					if closing != ']' && i+1 < len(runes) && runes[i+1] == closing {
+						b.WriteRune(closing)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			kind := sqlQuotedIdent
+			if r == '\'' {
+				kind = sqlString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: b.String(), pos: start})
+
+		default:
+			i++
+			if i < len(runes) {
+				switch string(runes[start : i+1]) {
+				case "<=", ">=", "<>", "!=":
+					i++
+				}
+			}
+			symbol := string(runes[start:i])
+			if !strings.Contains(" = < > <= >= <> != + - * / % ( ) , . ; ", " "+symbol+" ") {
+				return nil, fmt.Errorf("sql query: unexpected character '%s' at position %d", symbol, start+1)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, text: symbol, pos: start})
+		}
+	}
+	return append(tokens, sqlToken{kind: sqlEOF, pos: len(runes)}), nil
+}
+
+// Words that end an expression or table name, so they cannot be used as aliases without AS.
+var sqlReserved = []string{
+	"SELECT", "DISTINCT", "FROM", "WHERE", "GROUP", "BY", "HAVING", "ORDER", "LIMIT", "OFFSET",
+	"JOIN", "INNER", "LEFT", "OUTER", "ON", "AS", "AND", "OR", "NOT", "IN", "IS", "NULL",
+	"LIKE", "BETWEEN", "ASC", "DESC",
+}
+
+type sqlSelect struct {
+	distinct bool
+	items    []sqlSelectItem
+	from     sqlTableRef
+	joins    []sqlJoin
+	where    sqlExpr
+	groupBy  []sqlExpr
+	having   sqlExpr
+	orderBy  []sqlOrder
+	// Negative when there is no limit.
+	limit  int
+	offset int
+}
+
+type sqlSelectItem struct {
+	expr  sqlExpr
+	alias string
+	// Set for * and table.*, with table empty for *.
+	star  bool
+	table string
+}
+
+type sqlTableRef struct {
+	name, alias string
+}
+
+type sqlJoin struct {
+	table sqlTableRef
+	left  bool
+	on    sqlExpr
+}
+
+type sqlOrder struct {
+	expr sqlExpr
+	desc bool
+}
+
+// Expressions of a parsed query. Column positions are filled in when the query is planned.
+type sqlExpr interface {
+	String() string
+}
+
+type sqlColumn struct {
+	table, name string
+	pos         int
+}
+
+type sqlLiteral struct {
+	value string
+	// Written as a number rather than a quoted string.
+	number bool
+}
+
+type sqlUnary struct {
+	op   string
+	expr sqlExpr
+}
+
+type sqlBinary struct {
+	op          string
+	left, right sqlExpr
+}
+
+type sqlIn struct {
+	expr sqlExpr
+	list []sqlExpr
+	not  bool
+}
+
+type sqlBetween struct {
+	expr, low, high sqlExpr
+	not             bool
+}
+
+type sqlLike struct {
+	expr, pattern sqlExpr
+	not           bool
+	// Compiled when the query is planned if the pattern is a literal.
+	re *regexp.Regexp
+}
+
+type sqlIsNull struct {
+	expr sqlExpr
+	not  bool
+}
+
+// Call to an aggregate function. The argument is nil for COUNT(*).
+type sqlAggregate struct {
+	name     string
+	arg      sqlExpr
+	distinct bool
+}
+
+func (e *sqlColumn) String() string {
+	if len(e.table) > 0 {
+		return e.table + "." + e.name
+	}
+	return e.name
+}
+
+func (e *sqlLiteral) String() string {
+	if e.number {
+		return e.value
+	}
+	return "'" + strings.ReplaceAll(e.value, "'", "''") + "'"
+}
+
+func (e *sqlUnary) String() string {
+	if e.op == "-" {
+		return "-" + e.expr.String()
+	}
+	return e.op + " " + e.expr.String()
+}
+
+func (e *sqlBinary) String() string {
+	return e.left.String() + " " + e.op + " " + e.right.String()
+}
+
+func (e *sqlIn) String() string {
+	items := make([]string, len(e.list))
+	for i, item := range e.list {
+		items[i] = item.String()
+	}
+	return e.expr.String() + sqlNot(e.not) + " IN (" + strings.Join(items, ", ") + ")"
+}
+
+func (e *sqlBetween) String() string {
+	return e.expr.String() + sqlNot(e.not) + " BETWEEN " + e.low.String() + " AND " + e.high.String()
+}
+
+func (e *sqlLike) String() string {
+	return e.expr.String() + sqlNot(e.not) + " LIKE " + e.pattern.String()
+}
+
+func (e *sqlIsNull) String() string {
+	if e.not {
+		return e.expr.String() + " IS NOT NULL"
+	}
+	return e.expr.String() + " IS NULL"
+}
+
+func (e *sqlAggregate) String() string {
+	if e.arg == nil {
+		return e.name + "(*)"
+	}
+	if e.distinct {
+		return e.name + "(DISTINCT " + e.arg.String() + ")"
+	}
+	return e.name + "(" + e.arg.String() + ")"
+}
+
+func sqlNot(negated bool) string {
+	if negated {
+		return " NOT"
+	}
+	return ""
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+func parseSQL(query string) (*sqlSelect, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	p.symbol(";")
+	if p.peek().kind != sqlEOF {
+		return nil, p.unexpected()
+	}
+	return stmt, nil
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != sqlEOF {
+		p.pos++
+	}
+	return t
+}
+
+// Consumes the keyword when it is next.
+func (p *sqlParser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == sqlIdent && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// Consumes the symbol when it is next.
+func (p *sqlParser) symbol(s string) bool {
+	t := p.peek()
+	if t.kind == sqlSymbol && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(word string) error {
+	if !p.keyword(word) {
+		return fmt.Errorf("sql query: expected %s at position %d", word, p.peek().pos+1)
+	}
+	return nil
+}
+
+func (p *sqlParser) expectSymbol(s string) error {
+	if !p.symbol(s) {
+		return fmt.Errorf("sql query: expected '%s' at position %d", s, p.peek().pos+1)
+	}
+	return nil
+}
+
+func (p *sqlParser) unexpected() error {
+	t := p.peek()
+	if t.kind == sqlEOF {
+		return fmt.Errorf("sql query: unexpected end of query")
+	}
+	return fmt.Errorf("sql query: unexpected '%s' at position %d", t.text, t.pos+1)
+}
+
+func (p *sqlParser) reserved() bool {
+	t := p.peek()
+	if t.kind != sqlIdent {
+		return false
+	}
+	for _, word := range sqlReserved {
+		if strings.EqualFold(t.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads a table, column or alias name.
+func (p *sqlParser) identifier() (string, error) {
+	t := p.peek()
+	if t.kind == sqlQuotedIdent || (t.kind == sqlIdent && !p.reserved()) {
+		p.pos++
+		return t.text, nil
+	}
+	return "", p.unexpected()
+}
+
+// Reads an optional alias, written with or without AS.
+func (p *sqlParser) alias() (string, error) {
+	if p.keyword("AS") {
+		return p.identifier()
+	}
+	if t := p.peek(); t.kind == sqlQuotedIdent || (t.kind == sqlIdent && !p.reserved()) {
+		return p.identifier()
+	}
+	return "", nil
+}
+
+func (p *sqlParser) parseSelect() (*sqlSelect, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &sqlSelect{limit: -1}
+	stmt.distinct = p.keyword("DISTINCT")
+
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.items = append(stmt.items, item)
+		if !p.symbol(",") {
+			break
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.from, err = p.parseTable(); err != nil {
+		return nil, err
+	}
+
+	for {
+		join, ok, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		stmt.joins = append(stmt.joins, join)
+	}
+
+	if p.keyword("WHERE") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if stmt.groupBy, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("HAVING") {
+		if stmt.having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			order := sqlOrder{expr: expr}
+			if p.keyword("DESC") {
+				order.desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			stmt.orderBy = append(stmt.orderBy, order)
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		if stmt.limit, err = p.count(); err != nil {
+			return nil, err
+		}
+		if p.keyword("OFFSET") {
+			if stmt.offset, err = p.count(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stmt, nil
+}
+
+// Reads a join when one is next.
+func (p *sqlParser) parseJoin() (sqlJoin, bool, error) {
+	join := sqlJoin{}
+	switch {
+	case p.keyword("JOIN"):
+	case p.keyword("INNER"):
+		if err := p.expectKeyword("JOIN"); err != nil {
+			return join, false, err
+		}
+	case p.keyword("LEFT"):
+		p.keyword("OUTER")
+		if err := p.expectKeyword("JOIN"); err != nil {
+			return join, false, err
+		}
+		join.left = true
+	default:
+		return join, false, nil
+	}
+
+	var err error
+	if join.table, err = p.parseTable(); err != nil {
+		return join, false, err
+	}
+	if err := p.expectKeyword("ON"); err != nil {
+		return join, false, err
+	}
+	if join.on, err = p.parseExpr(); err != nil {
+		return join, false, err
+	}
+	return join, true, nil
+}
+
+func (p *sqlParser) count() (int, error) {
+	t := p.peek()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != sqlNumber || err != nil || n < 0 {
+		return 0, fmt.Errorf("sql query: expected a whole number at position %d", t.pos+1)
+	}
+	p.pos++
+	return n, nil
+}
+
+func (p *sqlParser) parseSelectItem() (sqlSelectItem, error) {
+	if p.symbol("*") {
+		return sqlSelectItem{star: true}, nil
+	}
+	// table.*
+	if t := p.peek(); (t.kind == sqlIdent || t.kind == sqlQuotedIdent) && p.pos+2 < len(p.tokens) &&
+		p.tokens[p.pos+1].text == "." && p.tokens[p.pos+2].kind == sqlSymbol && p.tokens[p.pos+2].text == "*" {
+		p.pos += 3
+		return sqlSelectItem{star: true, table: t.text}, nil
+	}
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return sqlSelectItem{}, err
+	}
+	alias, err := p.alias()
+	if err != nil {
+		return sqlSelectItem{}, err
+	}
+	return sqlSelectItem{expr: expr, alias: alias}, nil
+}
+
+func (p *sqlParser) parseTable() (sqlTableRef, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return sqlTableRef{}, err
+	}
+	alias, err := p.alias()
+	if err != nil {
+		return sqlTableRef{}, err
+	}
+	if len(alias) == 0 {
+		alias = name
+	}
+	return sqlTableRef{name: name, alias: alias}, nil
+}
+
+func (p *sqlParser) parseExprList() ([]sqlExpr, error) {
+	var list []sqlExpr
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+		if !p.symbol(",") {
+			return list, nil
+		}
+	}
+}
+
+// Operators from lowest to highest precedence: OR, AND, NOT, comparisons, + and -, * / and %, unary minus.
+func (p *sqlParser) parseExpr() (sqlExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinary{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAnd() (sqlExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinary{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseNot() (sqlExpr, error) {
+	if p.keyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlUnary{op: "NOT", expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *sqlParser) parseComparison() (sqlExpr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == sqlSymbol {
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.pos++
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := t.text
+			if op == "<>" {
+				op = "!="
+			}
+			return &sqlBinary{op: op, left: left, right: right}, nil
+		}
+	}
+
+	if p.keyword("IS") {
+		negated := p.keyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &sqlIsNull{expr: left, not: negated}, nil
+	}
+
+	negated := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		list, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &sqlIn{expr: left, list: list, not: negated}, nil
+	case p.keyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlBetween{expr: left, low: low, high: high, not: negated}, nil
+	case p.keyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlLike{expr: left, pattern: pattern, not: negated}, nil
+	}
+	if negated {
+		return nil, p.unexpected()
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAdditive() (sqlExpr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != sqlSymbol || (t.text != "+" && t.text != "-") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinary{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *sqlParser) parseMultiplicative() (sqlExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != sqlSymbol || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinary{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *sqlParser) parseUnary() (sqlExpr, error) {
+	if p.symbol("-") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlUnary{op: "-", expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+// Aggregate functions supported in queries.
+var sqlAggregates = []string{"SUM", "AVG", "MIN", "MAX", "COUNT", "STDDEV"}
+
+func (p *sqlParser) parsePrimary() (sqlExpr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == sqlNumber:
+		p.pos++
+		if _, err := strconv.ParseFloat(t.text, 64); err != nil {
+			return nil, fmt.Errorf("sql query: invalid number '%s' at position %d", t.text, t.pos+1)
+		}
+		return &sqlLiteral{value: t.text, number: true}, nil
+
+	case t.kind == sqlString:
+		p.pos++
+		return &sqlLiteral{value: t.text}, nil
+
+	case p.keyword("NULL"):
+		return &sqlLiteral{}, nil
+
+	case p.symbol("("):
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+
+	case t.kind == sqlIdent && p.tokens[p.pos+1].text == "(" && p.tokens[p.pos+1].kind == sqlSymbol:
+		return p.parseAggregate()
+	}
+
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if p.symbol(".") {
+		column, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlColumn{table: name, name: column}, nil
+	}
+	return &sqlColumn{name: name}, nil
+}
+
+func (p *sqlParser) parseAggregate() (sqlExpr, error) {
+	t := p.next()
+	name := strings.ToUpper(t.text)
+	supported := false
+	for _, agg := range sqlAggregates {
+		supported = supported || agg == name
+	}
+	if !supported {
+		return nil, fmt.Errorf("sql query: unknown function %s at position %d", t.text, t.pos+1)
+	}
+	p.next()
+
+	agg := &sqlAggregate{name: name}
+	if name == "COUNT" && p.symbol("*") {
+		return agg, p.expectSymbol(")")
+	}
+	agg.distinct = p.keyword("DISTINCT")
+
+	var err error
+	if agg.arg, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	return agg, p.expectSymbol(")")
+}
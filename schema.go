@@ -0,0 +1,361 @@
+package dataframe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Column data type inferred from the values in a DataFrame.
+type ColumnType int
+
+const (
+	VarcharType ColumnType = iota
+	IntegerType
+	DecimalType
+	DateType
+	TimestampType
+)
+
+func (t ColumnType) String() string {
+	switch t {
+	case IntegerType:
+		return "integer"
+	case DecimalType:
+		return "decimal"
+	case DateType:
+		return "date"
+	case TimestampType:
+		return "timestamp"
+	default:
+		return "varchar"
+	}
+}
+
+// Values longer than this are stored as TEXT instead of VARCHAR.
+const maxVarcharLength = 1024
+
+// Description of a single column inferred from the data in the DataFrame.
+type ColumnSchema struct {
+	Name string
+	Type ColumnType
+	// Longest value in characters.
+	Length int
+	// Total digits and digits after the decimal point for DecimalType.
+	Precision int
+	Scale     int
+	// Largest absolute integer value, used to pick INT or BIGINT.
+	MaxInt int64
+	// True when at least one value is empty.
+	Nullable bool
+}
+
+// Infers the type of every column in the DataFrame. Empty values are treated as NULL and do not
+// affect the type. Numbers with leading zeros (zip codes, account numbers) are kept as text.
+func (frame DataFrame) InferSchema() []ColumnSchema {
+	columns := frame.Columns()
+	schema := make([]ColumnSchema, len(columns))
+
+	for i, col := range columns {
+		pos := frame.Headers[col]
+		schema[i] = inferColumn(col, len(frame.FrameRecords), func(r int) string {
+			return frame.FrameRecords[r].Data[pos]
+		})
+	}
+	return schema
+}
+
+func inferColumn(name string, rows int, value func(row int) string) ColumnSchema {
+	col := ColumnSchema{Name: name}
+	isInt, isDecimal, isDate, isTimestamp := true, true, true, true
+	var seen bool
+	var intDigits int
+
+	for r := 0; r < rows; r++ {
+		val := value(r)
+		if n := utf8.RuneCountInString(val); n > col.Length {
+			col.Length = n
+		}
+		if len(val) == 0 {
+			col.Nullable = true
+			continue
+		}
+		seen = true
+
+		if isDate {
+			if _, err := parseDate(val); err != nil {
+				isDate = false
+			}
+		}
+		if isTimestamp {
+			if _, err := parseTimestamp(val); err != nil {
+				isTimestamp = false
+			}
+		}
+
+		if !isDecimal {
+			continue
+		}
+		whole, frac, ok := splitDecimal(val)
+		if !ok {
+			isInt, isDecimal = false, false
+			continue
+		}
+		if len(whole) > intDigits {
+			intDigits = len(whole)
+		}
+		if len(frac) > col.Scale {
+			col.Scale = len(frac)
+		}
+		if len(frac) > 0 {
+			isInt = false
+		}
+		if isInt {
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				isInt = false
+				continue
+			}
+			if n < 0 {
+				n = -n
+			}
+			if n > col.MaxInt {
+				col.MaxInt = n
+			}
+		}
+	}
+
+	switch {
+	case !seen:
+		col.Type = VarcharType
+	case isInt:
+		col.Type = IntegerType
+	case isDecimal:
+		col.Type = DecimalType
+		col.Precision = intDigits + col.Scale
+		if col.Precision == 0 {
+			col.Precision = 1
+		}
+	case isDate:
+		col.Type = DateType
+	case isTimestamp:
+		col.Type = TimestampType
+	default:
+		col.Type = VarcharType
+	}
+	if col.Type != DecimalType {
+		col.Scale = 0
+	}
+	return col
+}
+
+// Parses timestamps written as 2006-01-02 15:04:05 or RFC 3339.
+func parseTimestamp(val string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02 15:04:05", val); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, val)
+}
+
+// Splits a plain decimal number into its whole and fractional digits. Exponents,
+// thousands separators and leading zeros are rejected so such values stay text.
+func splitDecimal(val string) (string, string, bool) {
+	if val[0] == '-' || val[0] == '+' {
+		val = val[1:]
+	}
+	whole, frac, _ := strings.Cut(val, ".")
+	if len(whole) == 0 && len(frac) == 0 {
+		return "", "", false
+	}
+	for _, digits := range []string{whole, frac} {
+		for _, r := range digits {
+			if r < '0' || r > '9' {
+				return "", "", false
+			}
+		}
+	}
+	if len(whole) > 1 && whole[0] == '0' {
+		return "", "", false
+	}
+	if whole == "0" {
+		whole = ""
+	}
+	return whole, frac, true
+}
+
+// SQL type for the column in the given dialect.
+func (c ColumnSchema) SQLType(dialect Dialect) string {
+	switch c.Type {
+	case IntegerType:
+		if dialect == SQLite {
+			return "INTEGER"
+		}
+		if c.MaxInt > 2147483647 {
+			return "BIGINT"
+		}
+		if dialect == MySQL {
+			return "INT"
+		}
+		return "INTEGER"
+	case DecimalType:
+		if dialect == MySQL {
+			return fmt.Sprintf("DECIMAL(%d,%d)", c.Precision, c.Scale)
+		}
+		return fmt.Sprintf("NUMERIC(%d,%d)", c.Precision, c.Scale)
+	case DateType:
+		return "DATE"
+	case TimestampType:
+		switch dialect {
+		case MySQL:
+			return "DATETIME"
+		case Postgres:
+			return "TIMESTAMP"
+		default:
+			return "TEXT"
+		}
+	default:
+		if c.Length > maxVarcharLength || dialect == SQLite {
+			return "TEXT"
+		}
+		length := c.Length
+		if length == 0 {
+			length = 1
+		}
+		return fmt.Sprintf("VARCHAR(%d)", length)
+	}
+}
+
+// Generates a CREATE TABLE statement with the column types inferred from the DataFrame.
+func (frame DataFrame) CreateTableSQL(dialect Dialect, table string) string {
+	return createTableStatement(dialect, table, frame.InferSchema(), false)
+}
+
+func createTableStatement(dialect Dialect, table string, schema []ColumnSchema, ifNotExists bool) string {
+	var sb strings.Builder
+
+	sb.WriteString("CREATE TABLE ")
+	if ifNotExists {
+		sb.WriteString("IF NOT EXISTS ")
+	}
+	sb.WriteString(quoteTable(dialect, table))
+	sb.WriteString(" (\n")
+
+	for i, col := range schema {
+		sb.WriteString("  ")
+		sb.WriteString(quoteIdentifier(dialect, col.Name))
+		sb.WriteString(" ")
+		sb.WriteString(col.SQLType(dialect))
+		if !col.Nullable {
+			sb.WriteString(" NOT NULL")
+		}
+		if i < len(schema)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(")")
+
+	return sb.String()
+}
+
+// Schema of the DataFrame with the columns renamed to the provided table columns.
+func (frame DataFrame) tableSchema(tableColumns []string) []ColumnSchema {
+	schema := frame.InferSchema()
+	for i := range schema {
+		if i < len(tableColumns) {
+			schema[i].Name = tableColumns[i]
+		}
+	}
+	return schema
+}
+
+// Compares an existing table against the DataFrame. The provided table columns must be in
+// the same order as the DataFrame columns. Every problem found is returned in a single error.
+func (frame DataFrame) CheckTable(ctx context.Context, db *sql.DB, dialect Dialect, table string, tableColumns []string) error {
+	if db == nil {
+		return errors.New("check table error: database nil pointer")
+	}
+	if len(tableColumns) != len(frame.Headers) {
+		return errors.New("check table error: the provided columns do not match dataframe")
+	}
+	return checkTable(ctx, db, dialect, table, frame.tableSchema(tableColumns))
+}
+
+func checkTable(ctx context.Context, db *sql.DB, dialect Dialect, table string, schema []ColumnSchema) error {
+	rows, err := db.QueryContext(ctx, "SELECT * FROM "+quoteTable(dialect, table)+" WHERE 1=0")
+	if err != nil {
+		return fmt.Errorf("check table error: reading columns of '%s': %w", table, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf("check table error: reading columns of '%s': %w", table, err)
+	}
+
+	existing := make(map[string]*sql.ColumnType)
+	for _, ct := range columnTypes {
+		existing[strings.ToLower(ct.Name())] = ct
+	}
+
+	var problems []error
+	for _, col := range schema {
+		ct, ok := existing[strings.ToLower(col.Name)]
+		if !ok {
+			problems = append(problems, fmt.Errorf("column '%s' does not exist in table '%s'", col.Name, table))
+			continue
+		}
+		if err := compatibleColumn(col, ct); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("check table error: %w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// Checks that the values in a DataFrame column fit the database column.
+// Unknown database types are accepted as drivers report them inconsistently.
+func compatibleColumn(col ColumnSchema, ct *sql.ColumnType) error {
+	dbType := strings.ToUpper(ct.DatabaseTypeName())
+	if i := strings.IndexByte(dbType, '('); i >= 0 {
+		dbType = dbType[:i]
+	}
+	dbType = strings.TrimPrefix(strings.TrimSuffix(dbType, " UNSIGNED"), "UNSIGNED ")
+
+	// A column with only empty values is compatible with anything nullable.
+	if col.Length == 0 {
+		return nil
+	}
+
+	switch dbType {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "INT2", "INT4", "INT8", "SERIAL", "BIGSERIAL":
+		if col.Type != IntegerType {
+			return fmt.Errorf("column '%s' is %s in the table but contains %s values", col.Name, dbType, col.Type)
+		}
+	case "DECIMAL", "NUMERIC", "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8", "DOUBLE PRECISION":
+		if col.Type != IntegerType && col.Type != DecimalType {
+			return fmt.Errorf("column '%s' is %s in the table but contains %s values", col.Name, dbType, col.Type)
+		}
+	case "DATE":
+		if col.Type != DateType {
+			return fmt.Errorf("column '%s' is %s in the table but contains %s values", col.Name, dbType, col.Type)
+		}
+	case "DATETIME", "TIMESTAMP", "TIMESTAMPTZ":
+		if col.Type != DateType && col.Type != TimestampType {
+			return fmt.Errorf("column '%s' is %s in the table but contains %s values", col.Name, dbType, col.Type)
+		}
+	case "CHAR", "VARCHAR", "BPCHAR", "CHARACTER", "CHARACTER VARYING", "NVARCHAR", "NCHAR":
+		if length, ok := ct.Length(); ok && length > 0 && int64(col.Length) > length {
+			return fmt.Errorf("column '%s' allows %d characters but the longest value has %d", col.Name, length, col.Length)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,552 @@
+package dataframe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// SQL dialect used when generating statements.
+type Dialect int
+
+const (
+	MySQL Dialect = iota
+	Postgres
+	SQLite
+)
+
+// Determines how rows that collide with an existing primary or unique key are handled.
+type InsertMode int
+
+const (
+	// Plain INSERT. A conflicting row fails the whole batch.
+	Insert InsertMode = iota
+	// Conflicting rows are skipped (INSERT IGNORE / ON CONFLICT DO NOTHING).
+	InsertIgnore
+	// Conflicting rows are updated (ON DUPLICATE KEY UPDATE / ON CONFLICT DO UPDATE).
+	Upsert
+)
+
+// Settings used by BulkUpload.
+type BulkUploadOptions struct {
+	// Dialect of the target database. Defaults to MySQL.
+	Dialect Dialect
+	// Table columns in the same order as the DataFrame columns. Ignored when Mapping is provided.
+	Columns []string
+	// Explicit table columns and where their values come from. Only the mapped columns are uploaded.
+	Mapping []ColumnMapping
+	// Number of rows inserted per statement. Defaults to 1000.
+	RowsPerBatch int
+	// Conflict handling for duplicate keys. Defaults to Insert.
+	Mode InsertMode
+	// Key columns used by ON CONFLICT clauses. Required for Upsert with Postgres and SQLite
+	// and ignored by MySQL, which always uses the table's own keys.
+	ConflictColumns []string
+	// Columns overwritten on Upsert. Defaults to every column not in ConflictColumns.
+	UpdateColumns []string
+	// Run every batch in a single transaction that is rolled back if any batch fails.
+	Transaction bool
+	// Keep inserting the remaining batches after a batch fails. Ignored when Transaction is set.
+	ContinueOnError bool
+	// Create the table from the inferred schema when it does not exist yet.
+	CreateTable bool
+	// Compare the table's columns against the DataFrame before inserting anything.
+	CheckTable bool
+	// Receives the number of rows processed. Defaults to no reporting.
+	Progress ProgressReporter
+}
+
+// Summary of a BulkUpload. Rows that were never attempted because the upload
+// stopped early are counted as failed.
+type BulkUploadReport struct {
+	RowsInserted int64
+	RowsFailed   int64
+	Batches      int
+}
+
+// Converts a DataFrame value into the value bound to the SQL statement.
+type Converter func(value string) (interface{}, error)
+
+// Computes a value for a table column from the whole row.
+type ComputedValue func(row Record, headers map[string]int) (interface{}, error)
+
+// Describes where the value of a single table column comes from.
+type ColumnMapping struct {
+	// Table column receiving the value.
+	Column string
+	// DataFrame column providing the value. Ignored when Compute is set.
+	Source string
+	// Optional conversion applied to the Source value. Values are bound as strings without one.
+	Convert Converter
+	// Computes the value instead of reading Source. Used for constants and derived columns.
+	Compute ComputedValue
+}
+
+// Either a *sql.DB or a *sql.Tx.
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Bulk insert all rows of the DataFrame into a table. The upload stops when the context is cancelled.
+// When opts.Transaction is set nothing is kept unless every batch succeeds.
+func (frame DataFrame) BulkUpload(ctx context.Context, db *sql.DB, table string, opts BulkUploadOptions) (BulkUploadReport, error) {
+	progress := progressOrSilent(opts.Progress)
+	progress.Start("uploading to "+table, int64(len(frame.FrameRecords)), ProgressRows)
+
+	report, err := frame.bulkUpload(ctx, db, table, opts, progress)
+	return report, finishProgress(progress, err)
+}
+
+func (frame DataFrame) bulkUpload(ctx context.Context, db *sql.DB, table string, opts BulkUploadOptions, progress ProgressReporter) (BulkUploadReport, error) {
+	var report BulkUploadReport
+
+	if db == nil {
+		return report, errors.New("bulk upload error: database nil pointer")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts.RowsPerBatch < 1 {
+		opts.RowsPerBatch = 1000
+	}
+	if len(table) == 0 {
+		return report, errors.New("bulk upload error: must provide a table name")
+	}
+
+	mapping, err := frame.resolveMapping(opts)
+	if err != nil {
+		return report, err
+	}
+	opts.Columns = make([]string, len(mapping))
+	for i, m := range mapping {
+		opts.Columns[i] = m.Column
+	}
+
+	if opts.Mode == Upsert && opts.Dialect != MySQL && len(opts.ConflictColumns) == 0 {
+		return report, errors.New("bulk upload error: upsert requires conflict columns for this dialect")
+	}
+
+	total := int64(len(frame.FrameRecords))
+	stopOnError := opts.Transaction || !opts.ContinueOnError
+
+	// Values of every row when the schema is needed up front. They are inserted as they are, so
+	// conversions and computed values run once and the schema matches what is inserted.
+	var mapped [][]interface{}
+	var mapErrs []error
+	if opts.CreateTable || opts.CheckTable {
+		mapped, mapErrs = frame.mappedRows(mapping)
+		for r, err := range mapErrs {
+			if err != nil && stopOnError {
+				report.RowsFailed = total
+				return report, fmt.Errorf("bulk upload error: row %d: %w", r+1, err)
+			}
+		}
+		schema := mappedSchema(mapping, mapped)
+		if opts.CreateTable {
+			if _, err := db.ExecContext(ctx, createTableStatement(opts.Dialect, table, schema, true)); err != nil {
+				report.RowsFailed = total
+				return report, fmt.Errorf("bulk upload error: creating table: %w", err)
+			}
+		}
+		if opts.CheckTable {
+			if err := checkTable(ctx, db, opts.Dialect, table, schema); err != nil {
+				report.RowsFailed = total
+				return report, fmt.Errorf("bulk upload error: %w", err)
+			}
+		}
+	}
+
+	var exec preparer = db
+	var tx *sql.Tx
+	if opts.Transaction {
+		var err error
+		tx, err = db.BeginTx(ctx, nil)
+		if err != nil {
+			report.RowsFailed = total
+			return report, fmt.Errorf("bulk upload error: starting transaction: %w", err)
+		}
+		exec = tx
+	}
+
+	// Abandon the upload and account for every row that was not kept.
+	fail := func(err error) (BulkUploadReport, error) {
+		if tx != nil {
+			tx.Rollback()
+			report.RowsInserted = 0
+		}
+		report.RowsFailed = total - report.RowsInserted
+		return report, err
+	}
+
+	var batchErrs []error
+
+	for start := 0; start < len(frame.FrameRecords); start += opts.RowsPerBatch {
+		if err := ctx.Err(); err != nil {
+			return fail(fmt.Errorf("bulk upload error: %w", err))
+		}
+
+		end := start + opts.RowsPerBatch
+		if end > len(frame.FrameRecords) {
+			end = len(frame.FrameRecords)
+		}
+
+		bulkData := make([][]interface{}, 0, end-start)
+		for i, row := range frame.FrameRecords[start:end] {
+			var data []interface{}
+			var err error
+			if mapped != nil {
+				data, err = mapped[start+i], mapErrs[start+i]
+			} else {
+				data, err = frame.mappedValues(row, mapping)
+			}
+			if err != nil {
+				err = fmt.Errorf("bulk upload error: row %d: %w", start+i+1, err)
+				if stopOnError {
+					return fail(err)
+				}
+				report.RowsFailed++
+				batchErrs = append(batchErrs, err)
+				progress.Add(1)
+				continue
+			}
+			bulkData = append(bulkData, data)
+		}
+		if len(bulkData) == 0 {
+			continue
+		}
+
+		report.Batches++
+		if err := insertRows(ctx, exec, opts, bulkData, table); err != nil {
+			err = fmt.Errorf("bulk upload error: inserting records: %w", err)
+			if stopOnError {
+				return fail(err)
+			}
+			report.RowsFailed += int64(len(bulkData))
+			batchErrs = append(batchErrs, err)
+			progress.Add(int64(len(bulkData)))
+			continue
+		}
+		report.RowsInserted += int64(len(bulkData))
+		progress.Add(int64(len(bulkData)))
+	}
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return fail(fmt.Errorf("bulk upload error: committing transaction: %w", err))
+		}
+	}
+
+	return report, errors.Join(batchErrs...)
+}
+
+// Builds the column mapping from opts. Without an explicit mapping every DataFrame column is
+// uploaded to the table column in the same position.
+func (frame DataFrame) resolveMapping(opts BulkUploadOptions) ([]ColumnMapping, error) {
+	if len(opts.Mapping) == 0 {
+		if len(opts.Columns) == 0 {
+			return nil, errors.New("bulk upload error: must provide columns")
+		}
+
+		frameColumns := frame.Columns()
+		if len(opts.Columns) != len(frameColumns) {
+			return nil, errors.New("bulk upload error: the provided columns do not match dataframe")
+		}
+
+		mapping := make([]ColumnMapping, len(frameColumns))
+		for i, col := range frameColumns {
+			mapping[i] = ColumnMapping{Column: opts.Columns[i], Source: col}
+		}
+		return mapping, nil
+	}
+
+	for _, m := range opts.Mapping {
+		if len(m.Column) == 0 {
+			return nil, errors.New("bulk upload error: mapping is missing a table column")
+		}
+		if m.Compute != nil {
+			continue
+		}
+		if _, ok := frame.Headers[m.Source]; !ok {
+			return nil, fmt.Errorf("bulk upload error: mapped column '%s' not found in dataframe", m.Source)
+		}
+	}
+	return opts.Mapping, nil
+}
+
+// Values bound for a single row, in mapping order.
+func (frame DataFrame) mappedValues(row Record, mapping []ColumnMapping) ([]interface{}, error) {
+	data := make([]interface{}, len(mapping))
+
+	for i, m := range mapping {
+		if m.Compute != nil {
+			val, err := m.Compute(row, frame.Headers)
+			if err != nil {
+				return nil, fmt.Errorf("column '%s': %w", m.Column, err)
+			}
+			data[i] = val
+			continue
+		}
+
+		val := row.Data[frame.Headers[m.Source]]
+		if m.Convert == nil {
+			data[i] = val
+			continue
+		}
+
+		converted, err := m.Convert(val)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %w", m.Column, err)
+		}
+		data[i] = converted
+	}
+	return data, nil
+}
+
+// Values bound for every row along with the error of each row that could not be mapped.
+// The values of such rows are nil.
+func (frame DataFrame) mappedRows(mapping []ColumnMapping) ([][]interface{}, []error) {
+	rows := make([][]interface{}, len(frame.FrameRecords))
+	errs := make([]error, len(frame.FrameRecords))
+	for r, row := range frame.FrameRecords {
+		rows[r], errs[r] = frame.mappedValues(row, mapping)
+	}
+	return rows, errs
+}
+
+// Schema of the table columns as they will be uploaded, after conversions and computed values.
+// Rows that could not be mapped are left out.
+func mappedSchema(mapping []ColumnMapping, rows [][]interface{}) []ColumnSchema {
+	var values [][]string
+	for _, data := range rows {
+		if data == nil {
+			continue
+		}
+		row := make([]string, len(data))
+		for i, val := range data {
+			row[i] = sqlValueString(val)
+		}
+		values = append(values, row)
+	}
+
+	schema := make([]ColumnSchema, len(mapping))
+	for i, m := range mapping {
+		schema[i] = inferColumn(m.Column, len(values), func(r int) string { return values[r][i] })
+	}
+	return schema
+}
+
+// Text form of a bound value used for schema inference.
+func sqlValueString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Converter that binds empty values as NULL. Other values are passed to next,
+// or bound as strings when next is nil.
+func NullIfEmpty(next Converter) Converter {
+	return func(value string) (interface{}, error) {
+		if len(value) == 0 {
+			return nil, nil
+		}
+		if next == nil {
+			return value, nil
+		}
+		return next(value)
+	}
+}
+
+// Converter that binds values as int64.
+func ToInt(value string) (interface{}, error) {
+	return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+}
+
+// Converter that binds values as float64.
+func ToFloat(value string) (interface{}, error) {
+	return strconv.ParseFloat(strings.TrimSpace(value), 64)
+}
+
+// Converter that binds dates as time.Time. Accepts the same formats as ConvertToDate.
+func ToDate(value string) (interface{}, error) {
+	return parseDate(strings.TrimSpace(value))
+}
+
+// Converter that binds values as time.Time parsed with the provided layout.
+func ToTime(layout string) Converter {
+	return func(value string) (interface{}, error) {
+		return time.Parse(layout, strings.TrimSpace(value))
+	}
+}
+
+// Computed value that is the same for every row, such as a load timestamp or batch id.
+func Constant(value interface{}) ComputedValue {
+	return func(Record, map[string]int) (interface{}, error) {
+		return value, nil
+	}
+}
+
+// Bulk insert rows into a specified table.
+func insertRows(ctx context.Context, db preparer, opts BulkUploadOptions, bulkData [][]interface{}, table string) error {
+	sqlStr, err := insertStatement(opts, table, len(bulkData))
+	if err != nil {
+		return err
+	}
+
+	vals := make([]interface{}, 0, len(bulkData)*len(opts.Columns))
+	for _, data := range bulkData {
+		vals = append(vals, data...)
+	}
+
+	stmt, err := db.PrepareContext(ctx, sqlStr)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, vals...)
+	return err
+}
+
+// Builds a multi-row INSERT statement for the dialect and insert mode in opts.
+func insertStatement(opts BulkUploadOptions, table string, rows int) (string, error) {
+	var sb strings.Builder
+
+	switch {
+	case opts.Mode == InsertIgnore && opts.Dialect == MySQL:
+		sb.WriteString("INSERT IGNORE INTO ")
+	case opts.Mode == InsertIgnore && opts.Dialect == SQLite:
+		sb.WriteString("INSERT OR IGNORE INTO ")
+	default:
+		sb.WriteString("INSERT INTO ")
+	}
+
+	sb.WriteString(quoteTable(opts.Dialect, table))
+	sb.WriteString("(")
+	for i, col := range opts.Columns {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(quoteIdentifier(opts.Dialect, col))
+	}
+	sb.WriteString(") VALUES ")
+
+	placeholder := 1
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("(")
+		for i := range opts.Columns {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			if opts.Dialect == Postgres {
+				sb.WriteString("$" + strconv.Itoa(placeholder))
+			} else {
+				sb.WriteString("?")
+			}
+			placeholder++
+		}
+		sb.WriteString(")")
+	}
+
+	switch opts.Mode {
+	case Insert:
+	case InsertIgnore:
+		if opts.Dialect == Postgres {
+			sb.WriteString(" ON CONFLICT DO NOTHING")
+		}
+	case Upsert:
+		sb.WriteString(upsertClause(opts))
+	default:
+		return "", fmt.Errorf("unknown insert mode %d", opts.Mode)
+	}
+
+	return sb.String(), nil
+}
+
+func upsertClause(opts BulkUploadOptions) string {
+	update := opts.UpdateColumns
+	if len(update) == 0 {
+		for _, col := range opts.Columns {
+			if !slices.Contains(opts.ConflictColumns, col) {
+				update = append(update, col)
+			}
+		}
+	}
+
+	if opts.Dialect == MySQL {
+		// MySQL requires at least one assignment, so a no-op one is used when every column is a key.
+		if len(update) == 0 {
+			update = opts.Columns[:1]
+		}
+		parts := make([]string, len(update))
+		for i, col := range update {
+			q := quoteIdentifier(MySQL, col)
+			parts[i] = q + "=VALUES(" + q + ")"
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(parts, ",")
+	}
+
+	keys := make([]string, len(opts.ConflictColumns))
+	for i, col := range opts.ConflictColumns {
+		keys[i] = quoteIdentifier(opts.Dialect, col)
+	}
+	clause := " ON CONFLICT (" + strings.Join(keys, ",") + ")"
+
+	if len(update) == 0 {
+		return clause + " DO NOTHING"
+	}
+
+	parts := make([]string, len(update))
+	for i, col := range update {
+		q := quoteIdentifier(opts.Dialect, col)
+		parts[i] = q + "=excluded." + q
+	}
+	return clause + " DO UPDATE SET " + strings.Join(parts, ",")
+}
+
+// Quotes a column name for the dialect.
+func quoteIdentifier(dialect Dialect, name string) string {
+	quote := `"`
+	if dialect == MySQL {
+		quote = "`"
+	}
+	return quote + strings.ReplaceAll(name, quote, quote+quote) + quote
+}
+
+// Quotes a possibly schema qualified table name such as db.table.
+func quoteTable(dialect Dialect, table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(dialect, part)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,354 @@
+package dataframe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Details about a stored file.
+type FileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Backend that files are loaded from and saved to. Names always use forward slashes.
+// Missing files are reported with errors that match fs.ErrNotExist.
+type Storage interface {
+	Open(name string) (io.ReadCloser, error)
+	// Data is only guaranteed to be stored once Close returns without an error. Writers that also
+	// have a CloseWithError(err error) error method discard the data when it is called instead.
+	Create(name string) (io.WriteCloser, error)
+	// Names of all files starting with prefix in lexicographic order.
+	List(prefix string) ([]string, error)
+	Stat(name string) (FileInfo, error)
+}
+
+// Implemented by writers that can discard what was written instead of storing it.
+type aborter interface {
+	CloseWithError(err error) error
+}
+
+// Closes a file created by a Storage. When err is not nil the data is discarded if the writer supports
+// it, so a failed save does not replace the existing file.
+func closeStorageFile(file io.WriteCloser, err error) error {
+	if a, ok := file.(aborter); ok && err != nil {
+		return a.CloseWithError(err)
+	}
+	return file.Close()
+}
+
+// Returned by writes to storage that stopped accepting data, such as an S3 upload that failed.
+// The reason is reported when the file is closed.
+var errUploadFinished = errors.New("upload finished")
+
+// Reports whether the error of closing a file should be returned instead of the error of writing it,
+// either because writing succeeded or because it only failed as the storage stopped accepting data.
+func preferCloseError(writeErr, closeErr error) bool {
+	return closeErr != nil && (writeErr == nil || errors.Is(writeErr, errUploadFinished))
+}
+
+// Uses the local filesystem when no storage is provided.
+func storageOrLocal(s Storage) Storage {
+	if s == nil {
+		return LocalStorage{}
+	}
+	return s
+}
+
+// Joins a directory and file name into a storage name.
+func storageName(dir, fileName string) string {
+	return path.Join(filepath.ToSlash(dir), filepath.ToSlash(fileName))
+}
+
+// Files on the local filesystem, relative to Root. An empty Root uses the working directory.
+type LocalStorage struct {
+	Root string
+}
+
+func NewLocalStorage(root string) LocalStorage {
+	return LocalStorage{Root: root}
+}
+
+func (s LocalStorage) path(name string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(name))
+}
+
+func (s LocalStorage) Open(name string) (io.ReadCloser, error) {
+	return os.Open(s.path(name))
+}
+
+// Missing parent directories are created.
+func (s LocalStorage) Create(name string) (io.WriteCloser, error) {
+	p := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
+
+// Opens a file for writing at its end. The file is created when missing.
+func (s LocalStorage) Append(name string) (io.WriteCloser, error) {
+	p := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+}
+
+func (s LocalStorage) List(prefix string) ([]string, error) {
+	// Walk the deepest directory contained in the prefix.
+	dir := path.Dir(prefix + "x")
+
+	var names []string
+	err := filepath.WalkDir(s.path(dir), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		// Without a root the walked paths are already relative to the working directory or absolute.
+		name := filepath.ToSlash(p)
+		if len(s.Root) > 0 {
+			rel, err := filepath.Rel(s.Root, p)
+			if err != nil {
+				return err
+			}
+			name = filepath.ToSlash(rel)
+		}
+		if strings.HasPrefix(name, strings.TrimPrefix(prefix, "./")) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s LocalStorage) Stat(name string) (FileInfo, error) {
+	info, err := os.Stat(s.path(name))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Files kept in memory, mainly for tests. Safe for concurrent use. The zero value is an empty storage.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string]memoryFile)}
+}
+
+func (s *MemoryStorage) Open(name string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.files[path.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+// The file becomes visible once the writer is closed.
+func (s *MemoryStorage) Create(name string) (io.WriteCloser, error) {
+	return &memoryWriter{storage: s, name: path.Clean(name)}, nil
+}
+
+// Adds the written data to the end of the file once the writer is closed.
+func (s *MemoryStorage) Append(name string) (io.WriteCloser, error) {
+	return &memoryWriter{storage: s, name: path.Clean(name), append: true}, nil
+}
+
+func (s *MemoryStorage) List(prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names []string
+	for name := range s.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemoryStorage) Stat(name string) (FileInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.files[path.Clean(name)]
+	if !ok {
+		return FileInfo{}, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return FileInfo{Name: path.Clean(name), Size: int64(len(f.data)), ModTime: f.modTime}, nil
+}
+
+type memoryWriter struct {
+	storage *MemoryStorage
+	name    string
+	append  bool
+	buf     bytes.Buffer
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memoryWriter) Close() error {
+	w.storage.mu.Lock()
+	defer w.storage.mu.Unlock()
+
+	if w.storage.files == nil {
+		w.storage.files = make(map[string]memoryFile)
+	}
+	data := w.buf.Bytes()
+	if w.append {
+		existing := w.storage.files[w.name].data
+		data = append(existing[:len(existing):len(existing)], data...)
+	}
+	w.storage.files[w.name] = memoryFile{data: data, modTime: time.Now()}
+	return nil
+}
+
+// Discards the written data, leaving any existing file unchanged.
+func (w *memoryWriter) CloseWithError(err error) error {
+	w.buf.Reset()
+	return nil
+}
+
+// Objects in a single S3 bucket. Names are object keys.
+type S3Storage struct {
+	Bucket string
+	sess   *session.Session
+}
+
+func NewS3Storage(cfg S3Config, bucket string) (*S3Storage, error) {
+	if len(bucket) == 0 {
+		return nil, errors.New("s3 storage: must provide a bucket name")
+	}
+
+	sess, err := cfg.session()
+	if err != nil {
+		return nil, fmt.Errorf("s3 storage: %w", err)
+	}
+	return &S3Storage{Bucket: bucket, sess: sess}, nil
+}
+
+func (s *S3Storage) Open(name string) (io.ReadCloser, error) {
+	out, err := s3.New(s.sess).GetObject(&s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(name)})
+	if err != nil {
+		return nil, s3Error("open", name, err)
+	}
+	return out.Body, nil
+}
+
+// The object is uploaded while it is written and stored once the writer is closed.
+func (s *S3Storage) Create(name string) (io.WriteCloser, error) {
+	return s.upload(&s3manager.UploadInput{Bucket: aws.String(s.Bucket), Key: aws.String(name)}), nil
+}
+
+// Starts uploading the data written to the returned writer. Input describes the object apart from its body.
+func (s *S3Storage) upload(input *s3manager.UploadInput) *s3Writer {
+	pr, pw := io.Pipe()
+	w := &s3Writer{pw: pw, done: make(chan error, 1)}
+	input.Body = pr
+
+	go func() {
+		_, err := s3manager.NewUploader(s.sess).Upload(input)
+		// Unblock the writer if the upload stopped reading early.
+		pr.CloseWithError(errUploadFinished)
+		w.done <- s3Error("create", aws.StringValue(input.Key), err)
+	}()
+	return w
+}
+
+func (s *S3Storage) List(prefix string) ([]string, error) {
+	return listObjects(s.sess, s.Bucket, prefix, "")
+}
+
+func (s *S3Storage) Stat(name string) (FileInfo, error) {
+	head, err := s3.New(s.sess).HeadObject(&s3.HeadObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(name)})
+	if err != nil {
+		return FileInfo{}, s3Error("stat", name, err)
+	}
+	return FileInfo{Name: name, Size: aws.Int64Value(head.ContentLength), ModTime: aws.TimeValue(head.LastModified)}, nil
+}
+
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Stops the upload so the object is not stored, leaving any existing object unchanged. Returns the
+// error of the upload when it failed for another reason than being stopped.
+func (w *s3Writer) CloseWithError(err error) error {
+	w.pw.CloseWithError(err)
+	uploadErr := <-w.done
+
+	// Reading the body fails once the pipe is closed, so that error is the caller's own.
+	var aerr awserr.Error
+	if errors.As(uploadErr, &aerr) && aerr.Code() == "ReadRequestBody" {
+		return nil
+	}
+	return uploadErr
+}
+
+// Wraps S3 errors so missing objects match fs.ErrNotExist.
+func s3Error(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
@@ -0,0 +1,340 @@
+package dataframe
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// Settings used by NewStreamWriter.
+type StreamWriterOptions struct {
+	// Storage, compression, byte order mark and progress reporting. The byte order mark is only
+	// written to new files.
+	SaveOptions
+	// Delimiter of the written file. Defaults to csv.
+	Format FileFormat
+	// Adds rows to the end of an existing file instead of replacing it. The header in the file must
+	// match the columns. Files that do not exist yet are created. Requires storage that can append.
+	Append bool
+	// Number of rows buffered before they are flushed to the file. Defaults to 1000.
+	FlushEvery int
+}
+
+// Implemented by storage that can add data to the end of an existing file.
+type appender interface {
+	Append(name string) (io.WriteCloser, error)
+}
+
+// Writes rows to a csv file as they are produced, so the output never has to fit in memory.
+// The header is written once and every row is written in the order of the writer's columns,
+// matched by name. Safe for concurrent use.
+type StreamWriter struct {
+	mu         sync.Mutex
+	file       io.WriteCloser
+	compressor io.WriteCloser
+	csv        *csv.Writer
+	progress   ProgressReporter
+
+	columns       []string
+	headerWritten bool
+	flushEvery    int
+	pending       int
+	rows          int64
+	closed        bool
+
+	// Column positions resolved for the last header map seen.
+	headers   map[string]int
+	positions []int
+	row       []string
+}
+
+// Creates a writer for a csv file. When columns is nil they are taken from the existing file in
+// append mode or from the first row written. The .csv extension, or .tsv for FormatTSV, is added
+// when missing.
+func NewStreamWriter(path, fileName string, columns []string, opts StreamWriterOptions) (*StreamWriter, error) {
+	if opts.Format == FormatTSV {
+		fileName = tsvFileName(fileName)
+	} else {
+		fileName = csvFileName(fileName)
+	}
+	compression := opts.Compression
+	if compression == CompressionNone {
+		compression = compressionFromName(fileName)
+	} else if compressionFromName(fileName) != compression {
+		fileName += compression.extension()
+	}
+
+	storage := storageOrLocal(opts.Storage)
+	name := storageName(path, fileName)
+
+	w := &StreamWriter{
+		columns:    columns,
+		flushEvery: opts.FlushEvery,
+		progress:   progressOrSilent(opts.Progress),
+	}
+	if w.flushEvery < 1 {
+		w.flushEvery = 1000
+	}
+
+	var existing []string
+	var exists bool
+	if opts.Append {
+		var err error
+		existing, exists, err = readHeader(storage, name, opts.Format.delimiter(), EncodingAuto)
+		if err != nil {
+			return nil, fmt.Errorf("stream writer: reading the existing header: %w", err)
+		}
+		if exists && existing != nil {
+			if w.columns == nil {
+				w.columns = existing
+			} else if !slices.Equal(w.columns, existing) {
+				return nil, fmt.Errorf("stream writer: columns %v do not match the existing header %v", w.columns, existing)
+			}
+			w.headerWritten = true
+		}
+	}
+
+	var err error
+	if exists {
+		a, ok := storage.(appender)
+		if !ok {
+			return nil, errors.New("stream writer: the storage does not support appending")
+		}
+		w.file, err = a.Append(name)
+	} else {
+		w.file, err = storage.Create(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stream writer: opening the file: %w", err)
+	}
+
+	if w.compressor, err = compress(w.file, compression); err != nil {
+		closeStorageFile(w.file, err)
+		return nil, fmt.Errorf("stream writer: %w", err)
+	}
+	if opts.WriteBOM && !exists {
+		if _, err := w.compressor.Write(utf8BOM); err != nil {
+			w.compressor.Close()
+			closeStorageFile(w.file, err)
+			return nil, fmt.Errorf("stream writer: writing the byte order mark: %w", err)
+		}
+	}
+
+	w.csv = csv.NewWriter(w.compressor)
+	w.csv.Comma = opts.Format.delimiter()
+
+	if w.columns != nil && !w.headerWritten {
+		if err := w.writeHeader(); err != nil {
+			w.compressor.Close()
+			closeStorageFile(w.file, err)
+			return nil, err
+		}
+	}
+
+	w.progress.Start("saving "+fileName, -1, ProgressRows)
+	return w, nil
+}
+
+// Reads the header of an existing file. Reports whether the file exists; the header is nil for empty files.
+func readHeader(storage Storage, name string, comma rune, enc Encoding) ([]string, bool, error) {
+	file, err := storage.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	data, err := decompress(file)
+	if err != nil {
+		return nil, true, err
+	}
+	defer data.Close()
+
+	text, err := decode(data, enc)
+	if err != nil {
+		return nil, true, err
+	}
+
+	reader := csv.NewReader(text)
+	reader.FieldsPerRecord = -1
+	reader.Comma = comma
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, true, nil
+	} else if err != nil {
+		return nil, true, err
+	}
+	removeByteOrderMark(header)
+	return header, true, nil
+}
+
+// Same as csvFileName for tab separated files.
+func tsvFileName(fileName string) string {
+	if compressionFromName(fileName) != CompressionNone {
+		return fileName
+	}
+	if !strings.Contains(strings.ToLower(fileName), ".tsv") {
+		fileName = fileName + ".tsv"
+	}
+	return fileName
+}
+
+func (w *StreamWriter) writeHeader() error {
+	if err := w.csv.Write(w.columns); err != nil {
+		return fmt.Errorf("stream writer: writing the header: %w", err)
+	}
+	w.headerWritten = true
+	return nil
+}
+
+// Writes a single streamed row.
+func (w *StreamWriter) Write(row StreamingRecord) error {
+	return w.WriteRecord(Record{Data: row.Data}, row.Headers)
+}
+
+// Writes a single row whose columns are described by headers.
+func (w *StreamWriter) WriteRecord(row Record, headers map[string]int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writeRecord(row, headers)
+}
+
+// Writes every row of a DataFrame, such as a chunk from StreamChunks.
+func (w *StreamWriter) WriteFrame(frame DataFrame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, row := range frame.FrameRecords {
+		if err := w.writeRecord(row, frame.Headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *StreamWriter) writeRecord(row Record, headers map[string]int) error {
+	if w.closed {
+		return errors.New("stream writer: write after close")
+	}
+	if err := w.resolve(headers); err != nil {
+		return err
+	}
+
+	for i, pos := range w.positions {
+		if pos >= len(row.Data) {
+			return fmt.Errorf("stream writer: row %d has fewer values than columns", w.rows+1)
+		}
+		w.row[i] = row.Data[pos]
+	}
+	if err := w.csv.Write(w.row); err != nil {
+		return fmt.Errorf("stream writer: writing row %d: %w", w.rows+1, err)
+	}
+	w.rows++
+	w.progress.Add(1)
+
+	w.pending++
+	if w.pending >= w.flushEvery {
+		return w.flush()
+	}
+	return nil
+}
+
+// Matches the writer's columns to the header map, reusing the last result when rows share it.
+func (w *StreamWriter) resolve(headers map[string]int) error {
+	if w.headers != nil && sameMap(w.headers, headers) {
+		return nil
+	}
+
+	if w.columns == nil {
+		w.columns = make([]string, len(headers))
+		for name, pos := range headers {
+			if pos >= len(w.columns) {
+				return errors.New("stream writer: header positions are not contiguous")
+			}
+			w.columns[pos] = name
+		}
+	}
+	if !w.headerWritten {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	positions := make([]int, len(w.columns))
+	for i, col := range w.columns {
+		pos, ok := headers[col]
+		if !ok {
+			return fmt.Errorf("stream writer: row is missing column '%s'", col)
+		}
+		positions[i] = pos
+	}
+	w.headers, w.positions = headers, positions
+	w.row = make([]string, len(w.columns))
+	return nil
+}
+
+// Writes buffered rows to the file.
+func (w *StreamWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errors.New("stream writer: flush after close")
+	}
+	return w.flush()
+}
+
+func (w *StreamWriter) flush() error {
+	w.pending = 0
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return fmt.Errorf("stream writer: flushing: %w", err)
+	}
+	if f, ok := w.compressor.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return fmt.Errorf("stream writer: flushing: %w", err)
+		}
+	}
+	return nil
+}
+
+// Number of rows written so far, not counting the header.
+func (w *StreamWriter) Rows() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.rows
+}
+
+// Flushes the remaining rows and closes the file. The file is complete once Close returns without an error.
+func (w *StreamWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	w.csv.Flush()
+	err := w.csv.Error()
+	// The compressor is closed even after an error to release it.
+	if closeErr := w.compressor.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := closeStorageFile(w.file, err); preferCloseError(err, closeErr) {
+		err = closeErr
+	}
+	if err != nil {
+		err = fmt.Errorf("stream writer: closing the file: %w", err)
+	}
+	return finishProgress(w.progress, err)
+}
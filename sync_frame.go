@@ -0,0 +1,228 @@
+package dataframe
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DataFrame that is safe for concurrent use, e.g. when shared between HTTP handlers. Reads run at the
+// same time while changes are made one at a time. Frames returned by SyncFrame never share memory with
+// it, so they can be used freely after the call returns.
+type SyncFrame struct {
+	mu    sync.RWMutex
+	frame DataFrame
+}
+
+// Wraps a copy of the DataFrame, so later changes to frame are not seen by the SyncFrame.
+func NewSyncFrame(frame DataFrame) *SyncFrame {
+	return &SyncFrame{frame: frame.Copy()}
+}
+
+// Runs fn while holding the read lock. fn must not change the frame or keep it after returning.
+func (s *SyncFrame) Read(fn func(frame DataFrame)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fn(s.frame)
+}
+
+// Runs fn while holding the write lock, so it can change the frame in any way. fn must not keep the
+// frame after returning.
+func (s *SyncFrame) Write(fn func(frame *DataFrame) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return fn(&s.frame)
+}
+
+// Independent copy of the current contents.
+func (s *SyncFrame) Snapshot() DataFrame {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Copy()
+}
+
+func (s *SyncFrame) CountRecords() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.frame.FrameRecords)
+}
+
+func (s *SyncFrame) Columns() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Columns()
+}
+
+// Value of a field in the row at position i.
+func (s *SyncFrame) Val(i int, fieldName string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pos, err := s.position(i, fieldName)
+	if err != nil {
+		return "", err
+	}
+	return s.frame.FrameRecords[i].Data[pos], nil
+}
+
+// Copy of the values in the row at position i.
+func (s *SyncFrame) Row(i int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if i < 0 || i >= len(s.frame.FrameRecords) {
+		return nil, fmt.Errorf("sync frame: row %d is out of range for %d rows", i, len(s.frame.FrameRecords))
+	}
+	return append([]string{}, s.frame.FrameRecords[i].Data...), nil
+}
+
+func (s *SyncFrame) position(i int, fieldName string) (int, error) {
+	if i < 0 || i >= len(s.frame.FrameRecords) {
+		return 0, fmt.Errorf("sync frame: row %d is out of range for %d rows", i, len(s.frame.FrameRecords))
+	}
+	pos, ok := s.frame.Headers[fieldName]
+	if !ok {
+		return 0, fmt.Errorf("sync frame: column '%s' does not exist", fieldName)
+	}
+	return pos, nil
+}
+
+func (s *SyncFrame) Sum(fieldName string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Sum(fieldName)
+}
+
+func (s *SyncFrame) Average(fieldName string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Average(fieldName)
+}
+
+func (s *SyncFrame) Max(fieldName string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Max(fieldName)
+}
+
+func (s *SyncFrame) Min(fieldName string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Min(fieldName)
+}
+
+func (s *SyncFrame) StandardDeviation(fieldName string) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.StandardDeviation(fieldName)
+}
+
+func (s *SyncFrame) Unique(fieldName string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Unique(fieldName)
+}
+
+func (s *SyncFrame) Filtered(fieldName string, value ...string) DataFrame {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Filtered(fieldName, value...)
+}
+
+func (s *SyncFrame) Exclude(fieldName string, value ...string) DataFrame {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.Exclude(fieldName, value...)
+}
+
+func (s *SyncFrame) GreaterThanOrEqualTo(fieldName string, value float64) (DataFrame, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.GreaterThanOrEqualTo(fieldName, value)
+}
+
+func (s *SyncFrame) LessThanOrEqualTo(fieldName string, value float64) (DataFrame, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.LessThanOrEqualTo(fieldName, value)
+}
+
+func (s *SyncFrame) KeepColumns(columns []string) DataFrame {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.frame.KeepColumns(columns)
+}
+
+// Adds a copy of the values as a new row. There must be one value per column.
+func (s *SyncFrame) AddRecord(newData []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(newData) != len(s.frame.Headers) {
+		return fmt.Errorf("sync frame: record has %d values but the frame has %d columns", len(newData), len(s.frame.Headers))
+	}
+	s.frame = s.frame.AddRecord(newData)
+	return nil
+}
+
+// Sets the value of a field in the row at position i.
+func (s *SyncFrame) Update(i int, fieldName, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, err := s.position(i, fieldName)
+	if err != nil {
+		return err
+	}
+	s.frame.FrameRecords[i].Data[pos] = value
+	return nil
+}
+
+// Adds an empty column.
+func (s *SyncFrame) NewField(fieldName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.frame.Headers[fieldName]; ok {
+		return fmt.Errorf("sync frame: column '%s' already exists", fieldName)
+	}
+	s.frame.NewField(fieldName)
+	return nil
+}
+
+func (s *SyncFrame) Rename(originalColumnName, newColumnName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.frame.Rename(originalColumnName, newColumnName)
+}
+
+func (s *SyncFrame) Sort(fieldName string, ascending bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.frame.Sort(fieldName, ascending)
+}
+
+// Adds columns from dfRight as DataFrame.Merge does. dfRight must not be changed during the call.
+func (s *SyncFrame) Merge(dfRight *DataFrame, primaryKey string, columns ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.frame.Merge(dfRight, primaryKey, columns...)
+}
@@ -0,0 +1,208 @@
+package dataframe
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/slices"
+)
+
+// Read-only selection of rows from a DataFrame that refers to the parent's rows instead of copying them.
+// Changes made to values in the parent are visible through the view, while records added to the parent
+// afterwards are not. Use Materialize for an independent DataFrame.
+type View struct {
+	Headers map[string]int
+	records []Record
+	// Positions in records of the selected rows. Nil selects every row in order.
+	index []int
+}
+
+// View of every row in the DataFrame.
+func (frame DataFrame) View() View {
+	return View{Headers: frame.Headers, records: frame.FrameRecords}
+}
+
+// View of the first n rows.
+func (frame DataFrame) Head(n int) View {
+	return frame.View().Head(n)
+}
+
+// View of the last n rows.
+func (frame DataFrame) Tail(n int) View {
+	return frame.View().Tail(n)
+}
+
+// View of the rows from start up to but not including end. Bounds outside the frame are clamped.
+func (frame DataFrame) Slice(start, end int) View {
+	return frame.View().Slice(start, end)
+}
+
+// View of the rows at the given positions, in the given order. Positions may repeat.
+func (frame DataFrame) Take(indices ...int) (View, error) {
+	return frame.View().Take(indices...)
+}
+
+// Number of rows in the view.
+func (v View) Len() int {
+	if v.index == nil {
+		return len(v.records)
+	}
+	return len(v.index)
+}
+
+func (v View) CountRecords() int {
+	return v.Len()
+}
+
+// Position in the parent's rows of the i-th row of the view.
+func (v View) position(i int) int {
+	if v.index == nil {
+		return i
+	}
+	return v.index[i]
+}
+
+// The i-th row of the view. Its values are shared with the parent.
+func (v View) Row(i int) Record {
+	return v.records[v.position(i)]
+}
+
+// Value of a field in the i-th row of the view.
+func (v View) Val(i int, fieldName string) string {
+	return v.Row(i).Val(fieldName, v.Headers)
+}
+
+func (v View) Columns() []string {
+	return DataFrame{Headers: v.Headers}.Columns()
+}
+
+// Calls fn for every row of the view in order.
+func (v View) Each(fn func(i int, row Record)) {
+	for i := 0; i < v.Len(); i++ {
+		fn(i, v.Row(i))
+	}
+}
+
+func (v View) Head(n int) View {
+	return v.Slice(0, n)
+}
+
+func (v View) Tail(n int) View {
+	return v.Slice(v.Len()-n, v.Len())
+}
+
+// Rows from start up to but not including end of the view. Bounds outside the view are clamped.
+func (v View) Slice(start, end int) View {
+	start = min(max(start, 0), v.Len())
+	end = min(max(end, start), v.Len())
+
+	if v.index == nil {
+		v.records = v.records[start:end:end]
+		return v
+	}
+	v.index = v.index[start:end:end]
+	return v
+}
+
+// Rows at the given positions of the view, in the given order. Positions may repeat.
+func (v View) Take(indices ...int) (View, error) {
+	index := make([]int, len(indices))
+	for i, pos := range indices {
+		if pos < 0 || pos >= v.Len() {
+			return View{}, fmt.Errorf("take: position %d is out of range for %d rows", pos, v.Len())
+		}
+		index[i] = v.position(pos)
+	}
+	v.index = index
+	return v, nil
+}
+
+// Rows for which fn returns true, in the same order.
+func (v View) Filter(fn func(row StreamingRecord) bool) View {
+	index := []int{}
+	for i := 0; i < v.Len(); i++ {
+		pos := v.position(i)
+		if fn(StreamingRecord{Data: v.records[pos].Data, Headers: v.Headers}) {
+			index = append(index, pos)
+		}
+	}
+	v.index = index
+	return v
+}
+
+// Rows whose field matches one of the values, in the same order.
+func (v View) Filtered(fieldName string, value ...string) View {
+	col := v.column(fieldName)
+	return v.Filter(func(row StreamingRecord) bool {
+		return slices.Contains(value, row.Data[col])
+	})
+}
+
+// Rows whose field matches none of the values, in the same order.
+func (v View) Exclude(fieldName string, value ...string) View {
+	col := v.column(fieldName)
+	return v.Filter(func(row StreamingRecord) bool {
+		return !slices.Contains(value, row.Data[col])
+	})
+}
+
+func (v View) column(fieldName string) int {
+	col, ok := v.Headers[fieldName]
+	if !ok {
+		panic(fmt.Errorf("the provided field %s is not a valid field in the dataframe", fieldName))
+	}
+	return col
+}
+
+// DataFrame holding the rows of the view without copying their values. Only use it for reading, as
+// changes to values are made in the parent as well.
+func (v View) Frame() DataFrame {
+	if v.index == nil {
+		return DataFrame{FrameRecords: v.records[:len(v.records):len(v.records)], Headers: v.Headers}
+	}
+
+	records := make([]Record, len(v.index))
+	for i, pos := range v.index {
+		records[i] = v.records[pos]
+	}
+	return DataFrame{FrameRecords: records, Headers: v.Headers}
+}
+
+// Copies the rows of the view into a new DataFrame that is independent of the parent.
+func (v View) Materialize() DataFrame {
+	df := CreateNewDataFrame(v.Columns())
+	df.FrameRecords = make([]Record, v.Len())
+	for i := range df.FrameRecords {
+		df.FrameRecords[i] = Record{Data: slices.Clone(v.Row(i).Data)}
+	}
+	return df
+}
+
+func (v View) Sum(fieldName string) float64 {
+	frame := v.Frame()
+	return frame.Sum(fieldName)
+}
+
+func (v View) Average(fieldName string) float64 {
+	frame := v.Frame()
+	return frame.Average(fieldName)
+}
+
+func (v View) Max(fieldName string) float64 {
+	frame := v.Frame()
+	return frame.Max(fieldName)
+}
+
+func (v View) Min(fieldName string) float64 {
+	frame := v.Frame()
+	return frame.Min(fieldName)
+}
+
+func (v View) StandardDeviation(fieldName string) (float64, error) {
+	frame := v.Frame()
+	return frame.StandardDeviation(fieldName)
+}
+
+func (v View) Unique(fieldName string) []string {
+	frame := v.Frame()
+	return frame.Unique(fieldName)
+}